@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policies for grouping streamed LLM output into chunks before sending
+// it out
+const (
+	chunkNone     = "none"
+	chunkWord     = "word"
+	chunkSentence = "sentence"
+	chunkTime     = "time"
+)
+
+// chunker collects the pieces of text streamed in from the LLM and
+// hands them back in bigger chunks. Every paste goes through the
+// clipboard, so sending out every little piece is slow and floods
+// clipboard managers.
+type chunker struct {
+	policy   string
+	interval time.Duration
+	pending  string
+	last     time.Time
+}
+
+func newChunker(config *Config) *chunker {
+	return &chunker{policy: config.LLMChunking, interval: config.LLMChunkInterval, last: time.Now()}
+}
+
+// add adds a piece of text and returns the chunk that is ready to be
+// sent out, if any
+func (c *chunker) add(text string) string {
+	c.pending += text
+
+	end := 0
+	switch c.policy {
+	case chunkNone:
+		end = len(c.pending)
+	case chunkWord:
+		end = lastWordEnd(c.pending)
+	case chunkSentence:
+		end = lastSentenceEnd(c.pending)
+	case chunkTime:
+		if time.Since(c.last) >= c.interval {
+			end = lastWordEnd(c.pending)
+		}
+	}
+
+	chunk := c.pending[:end]
+	c.pending = c.pending[end:]
+	if len(chunk) > 0 {
+		c.last = time.Now()
+	}
+	return chunk
+}
+
+// flush returns whatever is left once the stream is done
+func (c *chunker) flush() string {
+	chunk := c.pending
+	c.pending = ""
+	return chunk
+}
+
+// lastWordEnd returns the position right after the last whitespace,
+// which is where the words that are complete end
+func lastWordEnd(text string) int {
+	i := strings.LastIndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return 0
+	}
+	_, size := utf8.DecodeRuneInString(text[i:])
+	return i + size
+}
+
+// Abbreviations that end in a period without ending the sentence
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "st": true, "vs": true,
+}
+
+// lastSentenceEnd returns the position right after the whitespace that
+// follows the last complete sentence or line
+func lastSentenceEnd(text string) int {
+	end := 0
+	for i, r := range text {
+		if !unicode.IsSpace(r) {
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(text[i:])
+		if r == '\n' || endsWithSentence(text[:i]) {
+			end = i + size
+		}
+	}
+	return end
+}
+
+// endsWithSentence reports if the text ends with the end of a sentence,
+// which a period after an abbreviation (e.g., Dr.) is not
+func endsWithSentence(text string) bool {
+	text = strings.TrimRight(text, `"')]”’`)
+	if strings.HasSuffix(text, "!") || strings.HasSuffix(text, "?") {
+		return true
+	}
+	if !strings.HasSuffix(text, ".") {
+		return false
+	}
+
+	word := text[strings.LastIndexFunc(text, unicode.IsSpace)+1 : len(text)-1]
+	word = strings.TrimLeft(word, `"'([“‘`)
+	return !strings.Contains(word, ".") && !abbreviations[strings.ToLower(word)]
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastWordEnd(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"Hello", 0},
+		{"Hello ", 6},
+		{"Hello wor", 6},
+		{"Hello\nwor", 6},
+		{"Hello world\t", 12},
+		{"Héllo wörld", 7},
+		{"Hello\u00a0wor", 7},
+	}
+
+	for _, tt := range tests {
+		got := lastWordEnd(tt.in)
+		if got != tt.want {
+			t.Errorf("lastWordEnd(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLastSentenceEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"no sentence", "Hello there", ""},
+		{"period", "Hello there. How", "Hello there. "},
+		{"question and exclamation marks", "Why? Because! And", "Why? Because! "},
+		{"last sentence", "One. Two. Three", "One. Two. "},
+		{"needs whitespace after", "Hello there.", ""},
+		{"closing quote", `He said "hi." Then`, `He said "hi." `},
+		{"closing curly quote", "He said “hi.” Then", "He said “hi.” "},
+		{"closing paren", "It works (mostly.) Next", "It works (mostly.) "},
+		{"newline", "First line\nSecond", "First line\n"},
+		{"newline without punctuation", "- one\n- two", "- one\n"},
+		{"abbreviation with dots", "Fruit, e.g. apples", ""},
+		{"abbreviation in parens", "Fruit (i.e. apples", ""},
+		{"title", "Ask Dr. Smith. He", "Ask Dr. Smith. "},
+		{"title in capitals", "Ask MR. Smith", ""},
+		{"initialism", "In the U.S. there", ""},
+		{"decimal", "It is 3.5 kg", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.in[:lastSentenceEnd(tt.in)]
+			if got != tt.want {
+				t.Errorf("lastSentenceEnd(%q) ends at %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunker(t *testing.T) {
+	pieces := []string{"Hel", "lo the", "re. How", " are", " you?\n", "Fine", "!"}
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{chunkNone, []string{"Hel", "lo the", "re. How", " are", " you?\n", "Fine", "!"}},
+		{chunkWord, []string{"Hello ", "there. ", "How ", "are you?\n", "Fine!"}},
+		{chunkSentence, []string{"Hello there. ", "How are you?\n", "Fine!"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			c := &chunker{policy: tt.policy, last: time.Now()}
+			var got []string
+			for _, piece := range pieces {
+				if chunk := c.add(piece); len(chunk) > 0 {
+					got = append(got, chunk)
+				}
+			}
+			if chunk := c.flush(); len(chunk) > 0 {
+				got = append(got, chunk)
+			}
+
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("chunks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
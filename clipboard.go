@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/atotto/clipboard"
+)
+
+// Selections that pasting can go through
+const (
+	selectionClipboard = "clipboard"
+	selectionPrimary   = "primary"
+)
+
+// selection is the clipboard or the primary selection, read and
+// written through wl-clipboard on Wayland
+type selection struct {
+	name    string
+	wayland bool
+}
+
+func (s selection) read() (string, error) {
+	if s.wayland {
+		// Only text, wl-paste would give us images as well
+		args := []string{"wl-paste", "--no-newline", "--type", "text"}
+		if s.name == selectionPrimary {
+			args = append(args, "--primary")
+		}
+		out, err := runSelectionCommand(nil, [][]string{args}, "")
+		return string(out), err
+	}
+
+	if s.name != selectionPrimary {
+		return clipboard.ReadAll()
+	}
+
+	out, err := runSelectionCommand(nil, [][]string{
+		{"xclip", "-out", "-selection", "primary"},
+		{"xsel", "--output", "--primary"},
+	}, "the primary selection needs xclip or xsel to be installed")
+	return string(out), err
+}
+
+func (s selection) write(text string) error {
+	if s.wayland {
+		args := []string{"wl-copy"}
+		if s.name == selectionPrimary {
+			args = append(args, "--primary")
+		}
+		_, err := runSelectionCommand(strings.NewReader(text), [][]string{args}, "")
+		return err
+	}
+
+	if s.name != selectionPrimary {
+		return clipboard.WriteAll(text)
+	}
+
+	_, err := runSelectionCommand(strings.NewReader(text), [][]string{
+		{"xclip", "-in", "-selection", "primary"},
+		{"xsel", "--input", "--primary"},
+	}, "the primary selection needs xclip or xsel to be installed")
+	return err
+}
+
+// runSelectionCommand runs the first of the commands that is installed,
+// failing with the message if none are. When writing, the output is not
+// captured as xclip and wl-copy stay around in the background to serve
+// the selection and would keep it open.
+func runSelectionCommand(stdin *strings.Reader, commands [][]string, missing string) ([]byte, error) {
+	for _, args := range commands {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(args[0], args[1:]...)
+		if stdin != nil {
+			cmd.Stdin = stdin
+			err := cmd.Run()
+			if err != nil {
+				return nil, fmt.Errorf("%s failed: %w", args[0], err)
+			}
+			return nil, nil
+		}
+
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return out, nil
+	}
+
+	if missing == "" {
+		missing = commands[0][0] + " is not installed"
+	}
+	return nil, fmt.Errorf("%s", missing)
+}
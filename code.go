@@ -0,0 +1,252 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Identifier casings for code mode
+const (
+	caseCamel          = "camel"
+	casePascal         = "pascal"
+	caseSnake          = "snake"
+	caseKebab          = "kebab"
+	caseScreamingSnake = "screaming_snake"
+	caseDotPath        = "dot_path"
+)
+
+// Spoken phrases in code mode. Casing phrases apply to the words that
+// follow them, up to the next symbol, code phrase or punctuation from
+// whisper. "end case" can be used to end it explicitly.
+var codeCasings = map[string]string{
+	"camel case":           caseCamel,
+	"pascal case":          casePascal,
+	"snake case":           caseSnake,
+	"kebab case":           caseKebab,
+	"screaming snake case": caseScreamingSnake,
+	"constant case":        caseScreamingSnake,
+	"dot path":             caseDotPath,
+}
+
+const (
+	codeString  = "string"
+	codeNumber  = "number"
+	codeEndCase = "end case"
+)
+
+// matchCodePhrase checks if the tokens start with the phrase and
+// returns the number of tokens it took up
+func matchCodePhrase(tokens []symbolToken, phrase string) int {
+	words := strings.Fields(phrase)
+	if len(words) > len(tokens) {
+		return 0
+	}
+
+	var spoken []string
+	for _, t := range tokens[:len(words)] {
+		if t.symbol {
+			return 0
+		}
+		spoken = append(spoken, t.text)
+	}
+
+	if normalizePhrase(strings.Join(spoken, " ")) != phrase {
+		return 0
+	}
+	return len(words)
+}
+
+// matchCasing returns the casing if the tokens start with a casing
+// phrase, preferring the longest one
+func matchCasing(tokens []symbolToken) (string, int) {
+	casing, used := "", 0
+	for phrase, c := range codeCasings {
+		if n := matchCodePhrase(tokens, phrase); n > used {
+			casing, used = c, n
+		}
+	}
+	return casing, used
+}
+
+func isCodePhrase(tokens []symbolToken) bool {
+	if _, n := matchCasing(tokens); n > 0 {
+		return true
+	}
+	return matchCodePhrase(tokens, codeNumber) > 0 || matchCodePhrase(tokens, codeEndCase) > 0
+}
+
+// atPhraseEdge reports if the token at i starts a phrase, which is at
+// the start, after a symbol or after punctuation from whisper. "string"
+// only starts a literal there, so that "a string value" stays text.
+func atPhraseEdge(tokens []symbolToken, i int) bool {
+	return i == 0 || tokens[i-1].symbol || endsPhrase(tokens[i-1].text)
+}
+
+// codeWords collects the plain words for a casing or a literal. It
+// stops at symbols, other code phrases and after a word that whisper
+// put punctuation after. An "end case" right after the words is taken
+// up as well.
+func codeWords(tokens []symbolToken) ([]string, int) {
+	var words []string
+	i := 0
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.symbol || isCodePhrase(tokens[i:]) {
+			break
+		}
+
+		// Whisper sometimes joins words with hyphens (user-id)
+		words = append(words, strings.FieldsFunc(strings.ToLower(t.text), func(r rune) bool {
+			return !isWordRune(r)
+		})...)
+
+		if trimPunctuation(t.text) != t.text {
+			i++
+			break
+		}
+	}
+
+	if n := matchCodePhrase(tokens[i:], codeEndCase); n > 0 {
+		i += n
+	}
+	return words, i
+}
+
+// applyCasing joins the lowercase words into an identifier
+func applyCasing(casing string, words []string) string {
+	switch casing {
+	case caseCamel:
+		for i := 1; i < len(words); i++ {
+			words[i] = capitalize(words[i])
+		}
+		return strings.Join(words, "")
+	case casePascal:
+		for i := range words {
+			words[i] = capitalize(words[i])
+		}
+		return strings.Join(words, "")
+	case caseSnake:
+		return strings.Join(words, "_")
+	case caseKebab:
+		return strings.Join(words, "-")
+	case caseScreamingSnake:
+		return strings.ToUpper(strings.Join(words, "_"))
+	case caseDotPath:
+		return strings.Join(words, ".")
+	}
+	return strings.Join(words, " ")
+}
+
+// uncapitalize undoes the capitalization whisper does at the start of
+// sentences. Words with other capitals in them (JSON, iPhone) are left
+// alone.
+func uncapitalize(word string) string {
+	runes := []rune(word)
+	if len(runes) == 0 || !unicode.IsUpper(runes[0]) {
+		return word
+	}
+	for _, r := range runes[1:] {
+		if unicode.IsUpper(r) {
+			return word
+		}
+	}
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// convertCode handles dictation in code mode. On top of symbol mode,
+// it supports casing phrases (camel case user id => userId), string
+// literals (string hello world => "hello world") and number literals
+// (number forty two => 42). Nothing is auto-capitalized.
+func convertCode(text string, symbols []symbol) string {
+	var reserved []string
+	for phrase := range codeCasings {
+		reserved = append(reserved, phrase)
+	}
+	tokens := tokenizeSymbols(text, symbols, reserved)
+
+	var out []symbolToken
+	sentenceStart := true
+	for i := 0; i < len(tokens); {
+		t := tokens[i]
+		if t.symbol {
+			out = append(out, t)
+			i++
+			continue
+		}
+
+		if casing, n := matchCasing(tokens[i:]); n > 0 {
+			words, used := codeWords(tokens[i+n:])
+			if len(words) > 0 {
+				out = append(out, symbolToken{text: applyCasing(casing, words), glue: glueNone})
+			}
+			i += n + used
+			sentenceStart = false
+			continue
+		}
+
+		if n := matchCodePhrase(tokens[i:], codeString); n > 0 && atPhraseEdge(tokens, i) {
+			words, used := codeWords(tokens[i+n:])
+			out = append(out, symbolToken{text: `"` + strings.Join(words, " ") + `"`, glue: glueNone})
+			i += n + used
+			sentenceStart = false
+			continue
+		}
+
+		if n := matchCodePhrase(tokens[i:], codeNumber); n > 0 {
+			// Whisper often gives us the number in digits already
+			if i+n < len(tokens) && !tokens[i+n].symbol {
+				if digits := trimPunctuation(tokens[i+n].text); isNumber(digits) {
+					out = append(out, symbolToken{text: digits, glue: glueNone})
+					i += n + 1
+					sentenceStart = false
+					continue
+				}
+			}
+
+			words, _ := codeWords(tokens[i+n:])
+			if number, used := parseNumberWords(words); used > 0 {
+				out = append(out, symbolToken{text: number, glue: glueNone})
+				i += n + numberTokens(tokens[i+n:], used)
+				sentenceStart = false
+				continue
+			}
+		}
+
+		if n := matchCodePhrase(tokens[i:], codeEndCase); n > 0 {
+			i += n
+			continue
+		}
+
+		word := trimPunctuation(t.text)
+		if sentenceStart {
+			word = uncapitalize(word)
+		}
+		if len(word) > 0 {
+			out = append(out, symbolToken{text: word, glue: glueNone})
+		}
+		sentenceStart = strings.ContainsAny(t.text[len(t.text)-1:], ".!?")
+		i++
+	}
+
+	return joinTokens(out)
+}
+
+// numberTokens maps the number of words parseNumberWords used back to
+// the number of tokens, as a token can have multiple words (forty-two)
+func numberTokens(tokens []symbolToken, words int) int {
+	i := 0
+	for ; i < len(tokens) && words > 0; i++ {
+		words -= len(strings.FieldsFunc(tokens[i].text, func(r rune) bool {
+			return !isWordRune(r)
+		}))
+	}
+	return i
+}
+
+// isNumber reports if the text is a number in digits, like 42, -8 or
+// 3.14. Words that parse as floats (nan, inf) are not numbers.
+func isNumber(text string) bool {
+	whole, fraction, found := strings.Cut(strings.TrimPrefix(text, "-"), ".")
+	return isDigits(whole) && (!found || isDigits(fraction))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertCode(t *testing.T) {
+	symbols, err := readSymbolTable(filepath.Join(t.TempDir(), "symbols"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"camel case", "camel case user id", "userId"},
+		{"pascal case", "pascal case http client", "HttpClient"},
+		{"snake case", "snake case max retries", "max_retries"},
+		{"kebab case", "kebab case main content", "main-content"},
+		{"screaming snake case", "screaming snake case max retries", "MAX_RETRIES"},
+		{"constant case", "constant case default timeout", "DEFAULT_TIMEOUT"},
+		{"dot path", "dot path os path join", "os.path.join"},
+		{"casing normalizes whisper casing", "Camel case user ID.", "userId"},
+		{"casing splits hyphenated words", "snake case user-id", "user_id"},
+		{"casing stops at symbols", "camel case user id equals snake case max retries", "userId = max_retries"},
+		{"casing stops at whisper punctuation", "Snake case max retries, is set", "max_retries is set"},
+		{"end case", "camel case is valid end case and done", "isValid and done"},
+		{"string literal", "string hello world", `"hello world"`},
+		{"empty string literal", "string", `""`},
+		{"string literal stops at symbols", "name equals string hello semicolon", `name = "hello";`},
+		{"string literal after punctuation", "Done. String hello", `done "hello"`},
+		{"not a string literal", "a string value", "a string value"},
+		{"string inside a casing", "camel case user string", "userString"},
+		{"number literal", "number forty two", "42"},
+		{"number literal with scale", "number three hundred and five thousand", "305000"},
+		{"negative decimal number literal", "number minus one point five", "-1.5"},
+		{"number literal from digits", "number 3.14", "3.14"},
+		{"hyphenated number literal", "number forty-two plus one", "42 + one"},
+		{"not a number literal", "number of items", "number of items"},
+		{"nan is not a number literal", "number nan", "number nan"},
+		{"inf is not a number literal", "number inf", "number inf"},
+		{"no auto capitalization", "Return the result.", "return the result"},
+		{"acronyms keep their case", "JSON dot parse", "JSON.parse"},
+		{"capitalization after sentence end", "Foo. Bar", "foo bar"},
+		{"symbols", "if open paren x less than number ten close paren", "if (x < 10)"},
+		{"everything together", "Const camel case max size equals number one hundred semicolon", "const maxSize = 100;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := convertCode(tt.in, symbols)
+			if got != tt.want {
+				t.Errorf("convertCode(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNumberWords(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want string
+		used int
+	}{
+		{[]string{"zero"}, "0", 1},
+		{[]string{"seven", "apples"}, "7", 1},
+		{[]string{"nineteen"}, "19", 1},
+		{[]string{"forty", "two"}, "42", 2},
+		{[]string{"two", "three"}, "2", 1},
+		{[]string{"twenty", "thirty"}, "20", 1},
+		{[]string{"one", "hundred", "and", "five"}, "105", 4},
+		{[]string{"one", "hundred", "and", "apples"}, "100", 2},
+		{[]string{"two", "thousand", "twenty", "four"}, "2024", 4},
+		{[]string{"three", "million"}, "3000000", 2},
+		{[]string{"three", "point", "one", "four"}, "3.14", 4},
+		{[]string{"one", "point"}, "1", 1},
+		{[]string{"minus", "eight"}, "-8", 2},
+		{[]string{"42"}, "42", 1},
+		{[]string{"minus"}, "", 0},
+		{[]string{"apples"}, "", 0},
+	}
+
+	for _, tt := range tests {
+		got, used := parseNumberWords(tt.in)
+		if got != tt.want || used != tt.used {
+			t.Errorf("parseNumberWords(%q) = %q, %d, want %q, %d", tt.in, got, used, tt.want, tt.used)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Actions that spoken commands can trigger
+const (
+	actionEnter     = "enter"
+	actionParagraph = "paragraph"
+	actionTab       = "tab"
+	actionScratch   = "scratch"
+	actionSelectAll = "select_all"
+
+	// Disables a built-in phrase
+	actionNone = "none"
+)
+
+// Built-in command phrases per language. The language is the same one
+// that is passed on to whisper.
+var defaultCommands = map[string]map[string]string{
+	"en": {
+		"new line":      actionEnter,
+		"new paragraph": actionParagraph,
+		"tab key":       actionTab,
+		"scratch that":  actionScratch,
+		"delete that":   actionScratch,
+		"select all":    actionSelectAll,
+	},
+	"de": {
+		"neue zeile":      actionEnter,
+		"neuer absatz":    actionParagraph,
+		"tabulator":       actionTab,
+		"lösch das":       actionScratch,
+		"alles auswählen": actionSelectAll,
+	},
+	"fr": {
+		"à la ligne":         actionEnter,
+		"nouvelle ligne":     actionEnter,
+		"nouveau paragraphe": actionParagraph,
+		"tabulation":         actionTab,
+		"efface ça":          actionScratch,
+		"tout sélectionner":  actionSelectAll,
+	},
+	"es": {
+		"nueva línea":      actionEnter,
+		"nuevo párrafo":    actionParagraph,
+		"tabulador":        actionTab,
+		"borra eso":        actionScratch,
+		"seleccionar todo": actionSelectAll,
+	},
+}
+
+func validAction(action string) bool {
+	switch action {
+	case actionEnter, actionParagraph, actionTab, actionScratch, actionSelectAll, actionNone:
+		return true
+	}
+	return false
+}
+
+// segment is either a piece of text to insert or an action to perform
+type segment struct {
+	text   string
+	action string
+}
+
+type command struct {
+	words  []string
+	action string
+}
+
+// commandTable returns the command phrases for the configured language,
+// longest first so that "new paragraph" is not mistaken for something
+// shorter. With automatic language detection, the phrases of all the
+// languages are used.
+func commandTable(config *Config) []command {
+	phrases := map[string]string{}
+	for _, table := range []map[string]map[string]string{defaultCommands, config.Commands} {
+		for language, commands := range table {
+			if language != config.Language && config.Language != "auto" {
+				continue
+			}
+			for phrase, action := range commands {
+				phrases[normalizePhrase(phrase)] = action
+			}
+		}
+	}
+
+	var commands []command
+	for phrase, action := range phrases {
+		if action == actionNone || len(phrase) == 0 {
+			continue
+		}
+		commands = append(commands, command{words: strings.Fields(phrase), action: action})
+	}
+
+	sort.Slice(commands, func(i, j int) bool {
+		if len(commands[i].words) != len(commands[j].words) {
+			return len(commands[i].words) > len(commands[j].words)
+		}
+		return strings.Join(commands[i].words, " ") < strings.Join(commands[j].words, " ")
+	})
+	return commands
+}
+
+// matchCommand checks if the words start with a command phrase and
+// returns the command along with the number of words it took up.
+func matchCommand(commands []command, words []string) (string, int) {
+	for _, c := range commands {
+		if len(c.words) > len(words) {
+			continue
+		}
+
+		// Words from whisper come with punctuation and casing
+		// attached, "New line." is the same as "new line".
+		if normalizePhrase(strings.Join(words[:len(c.words)], " ")) == strings.Join(c.words, " ") {
+			return c.action, len(c.words)
+		}
+	}
+	return "", 0
+}
+
+// parseCommands splits the transcript into text and the commands
+// spoken in between. Commands are only recognized at the edges of a
+// phrase, at the start or end of the transcript or next to punctuation
+// from whisper, so that "add a new line to the file" stays text. In
+// literal mode, everything is text.
+func parseCommands(config *Config, text string) []segment {
+	if config.LiteralMode || len(text) == 0 {
+		return []segment{{text: text}}
+	}
+
+	commands := commandTable(config)
+	words := strings.Fields(text)
+
+	var segments []segment
+	var pending []string
+	flush := func() {
+		if len(pending) > 0 {
+			segments = append(segments, segment{text: strings.Join(pending, " ")})
+			pending = nil
+		}
+	}
+
+	// Whether the word at i starts a phrase
+	start := true
+	for i := 0; i < len(words); {
+		action, n := matchCommand(commands, words[i:])
+		if n == 0 || !start && !endsCommand(commands, words, i+n) {
+			pending = append(pending, words[i])
+			start = endsPhrase(words[i])
+			i++
+			continue
+		}
+
+		flush()
+		segments = append(segments, segment{action: action})
+		start = true
+		i += n
+	}
+	flush()
+
+	return segments
+}
+
+// endsPhrase reports if whisper put punctuation after the word
+func endsPhrase(word string) bool {
+	return strings.ContainsAny(word[len(word)-1:], ".,;:!?")
+}
+
+// endsCommand reports if a command that ends right before the word at
+// end is followed by the end of a phrase, which can also be another
+// command (new paragraph new line)
+func endsCommand(commands []command, words []string, end int) bool {
+	if end == len(words) || endsPhrase(words[end-1]) {
+		return true
+	}
+	_, n := matchCommand(commands, words[end:])
+	return n > 0 && endsCommand(commands, words, end+n)
+}
+
+// Text that the commands standing for whitespace are sent as when they
+// go along with the text around them
+var actionText = map[string]string{
+	actionEnter:     "\n",
+	actionParagraph: "\n\n",
+	actionTab:       "\t",
+}
+
+// joinSegments joins text and the whitespace commands in between into
+// one piece of text, so that it can be post-processed as a whole.
+// Other commands, and whitespace commands before or after all of the
+// text, are kept as they are.
+func joinSegments(segments []segment) []segment {
+	var joined []segment
+	var run []segment
+	flush := func() {
+		first, last := -1, -1
+		for i, seg := range run {
+			if seg.action == "" {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if first < 0 {
+			joined = append(joined, run...)
+			run = nil
+			return
+		}
+
+		var sb strings.Builder
+		for _, seg := range run[first : last+1] {
+			sb.WriteString(seg.text + actionText[seg.action])
+		}
+		joined = append(joined, run[:first]...)
+		joined = append(joined, segment{text: sb.String()})
+		joined = append(joined, run[last+1:]...)
+		run = nil
+	}
+
+	for _, seg := range segments {
+		if _, found := actionText[seg.action]; found || seg.action == "" {
+			run = append(run, seg)
+			continue
+		}
+		flush()
+		joined = append(joined, seg)
+	}
+	flush()
+
+	return joined
+}
+
+func validateCommands(commands map[string]map[string]string) error {
+	for language, phrases := range commands {
+		for phrase, action := range phrases {
+			if !validAction(action) {
+				return fmt.Errorf("unknown action '%s' for command '%s' (%s)", action, phrase, language)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+type contextEntry struct {
+	text     string
+	duration time.Duration
+}
+
+// dictationContext keeps track of the recent transcripts so that they
+// can be passed on to whisper as context for the next dictation. This
+// helps whisper stay consistent in casing, spelling and style.
+type dictationContext struct {
+	entries []contextEntry
+	profile string
+	last    time.Time
+}
+
+// add records the transcript of a dictation along with the duration
+// of its audio
+func (c *dictationContext) add(config *Config, text string, duration time.Duration) {
+	if config.ContextDuration <= 0 || len(text) == 0 {
+		return
+	}
+
+	c.entries = append(c.entries, contextEntry{text: text, duration: duration})
+	c.profile = config.Profile
+	c.last = time.Now()
+
+	// Drop what we will never use again
+	var total time.Duration
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		total += c.entries[i].duration
+		if total >= config.ContextDuration {
+			c.entries = c.entries[i:]
+			break
+		}
+	}
+}
+
+// text returns the last ContextDuration worth of transcripts. If the
+// oldest transcript only partly fits, we take the words from its end
+// in proportion. The context is reset if we have been idle for too
+// long or if the profile changed.
+func (c *dictationContext) text(config *Config) string {
+	if config.ContextDuration <= 0 {
+		return ""
+	}
+
+	if time.Since(c.last) > config.ContextResetAfter || c.profile != config.Profile {
+		c.entries = nil
+		return ""
+	}
+
+	var parts []string
+	remaining := config.ContextDuration
+	for i := len(c.entries) - 1; i >= 0 && remaining > 0; i-- {
+		entry := c.entries[i]
+		text := entry.text
+		if entry.duration > remaining {
+			words := strings.Fields(text)
+			keep := int(float64(len(words)) * float64(remaining) / float64(entry.duration))
+			text = strings.Join(words[len(words)-keep:], " ")
+		}
+
+		if len(text) > 0 {
+			parts = append([]string{text}, parts...)
+		}
+		remaining -= entry.duration
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// trimToTokens drops words from the start of the text until it fits
+// within the token budget
+func trimToTokens(text string, budget int) string {
+	words := strings.Fields(text)
+	for len(words) > 0 && estimateTokens(strings.Join(words, " ")) > budget {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// buildPromptWithContext puts together the whisper prompt from the
+// dictionary and the previous transcripts. The context goes at the
+// end as that is what whisper sees as the text right before the
+// audio. It can take up to half of the token budget and the
+// dictionary gets the rest.
+func buildPromptWithContext(dictionary []dictionaryEntry, context string, budget int) (string, []dictionaryEntry) {
+	context = trimToTokens(context, budget/2)
+	prompt, dropped := buildPrompt(dictionary, budget-estimateTokens(context))
+
+	switch {
+	case len(context) == 0:
+		return prompt, dropped
+	case len(prompt) == 0:
+		return context, dropped
+	default:
+		return prompt + ". " + context, dropped
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Commands that can be sent to the running instance with `ojut ctl`
+var controlCommands = []string{"undo", "retry"}
+
+// controlRequest is a command from `ojut ctl`. These are handled by the
+// main loop in between dictations so that they do not interfere with
+// the output of a dictation.
+type controlRequest struct {
+	command string
+	reply   chan error
+}
+
+// controlSocket is where the running instance listens for commands
+func controlSocket() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("ojut-%d.sock", os.Getuid()))
+}
+
+// listenControl starts accepting commands from `ojut ctl` and passes
+// them on to the main loop
+func listenControl(requests chan<- controlRequest) (net.Listener, error) {
+	path := controlSocket()
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another instance is listening on %s", path)
+	}
+
+	// Left behind by an instance that did not exit cleanly
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleControl(conn, requests)
+		}
+	}()
+
+	return listener, nil
+}
+
+func handleControl(conn net.Conn, requests chan<- controlRequest) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	command := strings.TrimSpace(line)
+	known := false
+	for _, c := range controlCommands {
+		known = known || c == command
+	}
+	if !known {
+		fmt.Fprintf(conn, "error: unknown command '%s'\n", command)
+		return
+	}
+
+	req := controlRequest{command: command, reply: make(chan error, 1)}
+	requests <- req
+	if err := <-req.reply; err != nil {
+		fmt.Fprintf(conn, "error: %s\n", err)
+		return
+	}
+	fmt.Fprintf(conn, "ok\n")
+}
+
+// ctlCommand implements `ojut ctl <command>` which sends the command to
+// the running instance
+func ctlCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: ojut ctl <%s>\n", strings.Join(controlCommands, "|"))
+		return 2
+	}
+
+	conn, err := net.Dial("unix", controlSocket())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to connect to ojut, is it running? %s\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "%s\n", args[0])
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading response: %s\n", err)
+		return 1
+	}
+
+	response = strings.TrimSpace(response)
+	if message, found := strings.CutPrefix(response, "error: "); found {
+		fmt.Fprintf(os.Stderr, "%s\n", message)
+		return 1
+	}
+	return 0
+}
+
+// undoLast takes back the last dictation
+func undoLast(out *output) error {
+	text, err := out.undo()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Undid: %s\n", strings.TrimSpace(text))
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Whisper only looks at the last n_text_ctx/2 tokens of the prompt
+const defaultPromptTokenBudget = 224
+
+// dictionaryEntry is a line from one of the dictionary files. Lines
+// can optionally end with `| <priority>`, entries with a higher
+// priority make it into the prompt first.
+type dictionaryEntry struct {
+	term     string
+	priority int
+}
+
+func parseDictionaryEntry(line string) dictionaryEntry {
+	term, priority, found := strings.Cut(line, "|")
+	if !found {
+		return dictionaryEntry{term: line}
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(priority))
+	if err != nil {
+		return dictionaryEntry{term: line}
+	}
+	return dictionaryEntry{term: strings.TrimSpace(term), priority: value}
+}
+
+// dictionaryFiles returns the dictionary files to use in order. This
+// is the main dictionary file, everything in dictionary.d and any
+// additional files from the config. Directories in the config are
+// expanded like dictionary.d.
+func dictionaryFiles(config *Config) ([]string, error) {
+	files := []string{configPath("dictionary")}
+
+	dir, err := dictionaryDir(configPath("dictionary.d"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	files = append(files, dir...)
+
+	for _, file := range config.DictionaryFiles {
+		if !filepath.IsAbs(file) {
+			file = configPath(file)
+		}
+
+		if info, err := os.Stat(file); err == nil && info.IsDir() {
+			dir, err := dictionaryDir(file)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, dir...)
+			continue
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// dictionaryDir returns the files in the directory, in alphabetical
+// order. Hidden files and subdirectories are skipped.
+func dictionaryDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// loadDictionary reads all the dictionary files. If an entry shows up
+// in multiple files, the first one wins.
+func loadDictionary(config *Config) ([]dictionaryEntry, error) {
+	files, err := dictionaryFiles(config)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]struct{}{}
+	var dictionary []dictionaryEntry
+	for _, file := range files {
+		lines, err := readDictionaryFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		for _, line := range lines {
+			entry := parseDictionaryEntry(line)
+			if _, found := seen[entry.term]; found || len(entry.term) == 0 {
+				continue
+			}
+			seen[entry.term] = struct{}{}
+			dictionary = append(dictionary, entry)
+		}
+	}
+
+	return dictionary, nil
+}
+
+func dictionaryTerms(dictionary []dictionaryEntry) []string {
+	terms := make([]string, len(dictionary))
+	for i, entry := range dictionary {
+		terms[i] = entry.term
+	}
+	return terms
+}
+
+// estimateTokens gives a rough, slightly pessimistic, estimate of how
+// many tokens whisper will need for the text. We don't have the
+// tokenizer around, but common English words are mostly a token each
+// and longer or unusual words are split up into chunks of a few
+// characters.
+func estimateTokens(text string) int {
+	tokens := 0
+	for _, word := range strings.Fields(text) {
+		tokens += (len(word) + 2) / 3
+	}
+	return tokens
+}
+
+// buildPrompt fits as many dictionary entries as it can within the
+// token budget, highest priority first. The entries that did not fit
+// are returned as well.
+func buildPrompt(dictionary []dictionaryEntry, budget int) (string, []dictionaryEntry) {
+	sorted := slices.Clone(dictionary)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].priority > sorted[j].priority
+	})
+
+	included := map[string]struct{}{}
+	var dropped []dictionaryEntry
+	used := 0
+	for _, entry := range sorted {
+		// One extra for the separator
+		tokens := estimateTokens(entry.term) + 1
+		if used+tokens > budget {
+			dropped = append(dropped, entry)
+			continue
+		}
+
+		used += tokens
+		included[entry.term] = struct{}{}
+	}
+
+	// Keep the entries in the order they show up in the files
+	var terms []string
+	for _, entry := range dictionary {
+		if _, found := included[entry.term]; found {
+			terms = append(terms, entry.term)
+		}
+	}
+
+	return strings.Join(terms, ", "), dropped
+}
+
+// lastDropped is the number of entries dropped from the prompt the
+// last time, so that we only warn when that changes
+var lastDropped int
+
+func warnDroppedEntries(dropped []dictionaryEntry) {
+	if len(dropped) == lastDropped {
+		return
+	}
+	lastDropped = len(dropped)
+
+	if len(dropped) == 0 {
+		return
+	}
+
+	var terms []string
+	for _, entry := range dropped {
+		terms = append(terms, entry.term)
+	}
+	fmt.Fprintf(os.Stderr, "\x1b[2K\rDictionary is over the prompt token budget, dropped %d entries: %s\n",
+		len(dropped), strings.Join(terms, ", "))
+}
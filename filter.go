@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// What to do with known hallucinations on mostly silent audio
+const (
+	hallucinationDrop = "drop"
+	hallucinationFlag = "flag"
+)
+
+// If less than this fraction of the recording is speech, we consider
+// the audio to be mostly silent.
+const silentSpeechRatio = 0.2
+
+// Spans that might be non-speech annotations whisper adds. Eg: [Music],
+// [BLANK_AUDIO], (keyboard clicking), *laughs* or ♪
+var annotationRegex = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)|\*[^*]*\*|♪+`)
+
+// Words that make up the annotations. A span is only dropped if all of
+// its words are in here, so that dictated text in parens or asterisks
+// is left alone.
+var annotationWords = map[string]bool{
+	"blank_audio": true, "music": true, "playing": true, "upbeat": true, "soft": true,
+	"gentle": true, "dramatic": true, "background": true, "applause": true,
+	"laughter": true, "laughs": true, "laughing": true, "chuckles": true,
+	"chuckling": true, "sighs": true, "coughs": true, "coughing": true,
+	"silence": true, "inaudible": true, "noise": true, "static": true,
+	"keyboard": true, "clicking": true, "typing": true, "beep": true,
+	"beeping": true, "breathing": true, "footsteps": true, "speaking": true,
+	"foreign": true, "language": true, "no_speech": true, "indistinct": true,
+	"chatter": true, "wind": true, "blowing": true,
+}
+
+// isAnnotation reports if the span is a known non-speech annotation
+func isAnnotation(span string) bool {
+	if strings.HasPrefix(span, "♪") {
+		return true
+	}
+
+	words := strings.Fields(strings.ToLower(strings.Trim(span, "[]()*")))
+	if len(words) == 0 {
+		return false
+	}
+	for _, word := range words {
+		if !annotationWords[strings.Trim(word, ".,!")] {
+			return false
+		}
+	}
+	return true
+}
+
+var sentenceRegex = regexp.MustCompile(`[^.!?]+[.!?]*`)
+
+// Phrases whisper is known to make up when there is nothing (or just
+// noise) in the audio. Most of these come from the subtitles of
+// videos it was trained on.
+var defaultHallucinations = []string{
+	"thank you",
+	"thank you for watching",
+	"thank you so much for watching",
+	"thanks for watching",
+	"thank you for listening",
+	"please subscribe",
+	"please like and subscribe",
+	"subscribe to my channel",
+	"see you in the next video",
+	"see you next time",
+	"subtitles by the amara org community",
+	"transcribed by https otter ai",
+	"bye",
+	"you",
+}
+
+// normalizePhrase lowercases the text and drops everything other than
+// letters, digits and single spaces so that phrases can be compared
+// without having to worry about punctuation.
+func normalizePhrase(text string) string {
+	var sb strings.Builder
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r == '\'' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	}) {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(strings.ReplaceAll(word, "'", ""))
+	}
+	return sb.String()
+}
+
+// filterTranscript removes non-speech annotations and, when the audio
+// was mostly silent, sentences that are known hallucinations.
+func filterTranscript(config *Config, text string, speech float64) string {
+	if !config.KeepAnnotations {
+		text = annotationRegex.ReplaceAllStringFunc(text, func(span string) string {
+			if isAnnotation(span) {
+				return ""
+			}
+			return span
+		})
+		text = strings.Join(strings.Fields(text), " ")
+	}
+
+	if speech >= silentSpeechRatio {
+		return text
+	}
+
+	hallucinations := map[string]struct{}{}
+	for _, phrase := range append(defaultHallucinations, config.HallucinationPhrases...) {
+		hallucinations[normalizePhrase(phrase)] = struct{}{}
+	}
+
+	// Keeps the text unless it is a known hallucination that we have
+	// been asked to drop
+	keep := func(text string) bool {
+		if _, found := hallucinations[normalizePhrase(text)]; !found {
+			return true
+		}
+
+		if config.HallucinationAction == hallucinationFlag {
+			fmt.Fprintf(os.Stderr, "Possible hallucination (%.0f%% speech): %s\n", speech*100, text)
+			return true
+		}
+
+		fmt.Fprintf(os.Stderr, "Dropped likely hallucination (%.0f%% speech): %s\n", speech*100, text)
+		return false
+	}
+
+	// Some of the phrases contain periods (urls), so check the whole
+	// text before looking at individual sentences.
+	if _, found := hallucinations[normalizePhrase(text)]; found {
+		if keep(text) {
+			return text
+		}
+		return ""
+	}
+
+	var kept []string
+	for _, sentence := range sentenceRegex.FindAllString(text, -1) {
+		sentence = strings.TrimSpace(sentence)
+		if len(sentence) > 0 && keep(sentence) {
+			kept = append(kept, sentence)
+		}
+	}
+
+	return strings.Join(kept, " ")
+}
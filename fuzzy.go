@@ -0,0 +1,345 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/exp/slices"
+)
+
+// Dictionary entries with more words than this are not considered for
+// fuzzy matching
+const maxFuzzyWords = 3
+
+// Words shorter than this are left alone, there are too many short
+// words that sound alike. Dictionary entries can be a bit shorter as
+// they are usually merged from multiple words (oh jut => Ojut).
+const minFuzzyLength = 5
+const minFuzzyTermLength = 3
+
+func isVowel(c byte) bool {
+	return c == 'A' || c == 'E' || c == 'I' || c == 'O' || c == 'U'
+}
+
+// metaphone returns the phonetic key of a word using the original
+// Metaphone algorithm by Lawrence Philips. Only ASCII letters are
+// considered.
+func metaphone(word string) string {
+	var letters []byte
+	for _, r := range strings.ToUpper(word) {
+		if r >= 'A' && r <= 'Z' {
+			letters = append(letters, byte(r))
+		}
+	}
+	if len(letters) == 0 {
+		return ""
+	}
+
+	// Initial letter exceptions
+	switch {
+	case len(letters) > 1 && (string(letters[:2]) == "AE" || string(letters[:2]) == "GN" ||
+		string(letters[:2]) == "KN" || string(letters[:2]) == "PN" || string(letters[:2]) == "WR"):
+		letters = letters[1:]
+	case letters[0] == 'X':
+		letters[0] = 'S'
+	case len(letters) > 1 && string(letters[:2]) == "WH":
+		letters = append([]byte{'W'}, letters[2:]...)
+	}
+
+	at := func(i int) byte {
+		if i < 0 || i >= len(letters) {
+			return 0
+		}
+		return letters[i]
+	}
+	next := func(i int, s string) bool {
+		return strings.HasPrefix(string(letters[i+1:]), s)
+	}
+
+	var code strings.Builder
+	for i, c := range letters {
+		// Skip duplicate letters except C
+		if c != 'C' && i > 0 && at(i-1) == c {
+			continue
+		}
+
+		switch c {
+		case 'A', 'E', 'I', 'O', 'U':
+			if i == 0 {
+				code.WriteByte(c)
+			}
+		case 'B':
+			if !(at(i-1) == 'M' && i == len(letters)-1) {
+				code.WriteByte('B')
+			}
+		case 'C':
+			switch {
+			case next(i, "IA") || next(i, "H"):
+				if at(i-1) == 'S' {
+					code.WriteByte('K')
+				} else {
+					code.WriteByte('X')
+				}
+			case next(i, "I") || next(i, "E") || next(i, "Y"):
+				if at(i-1) != 'S' {
+					code.WriteByte('S')
+				}
+			default:
+				code.WriteByte('K')
+			}
+		case 'D':
+			if next(i, "GE") || next(i, "GY") || next(i, "GI") {
+				code.WriteByte('J')
+			} else {
+				code.WriteByte('T')
+			}
+		case 'G':
+			switch {
+			case next(i, "H") && i+2 < len(letters) && !isVowel(at(i+2)):
+			case next(i, "N") && (i+2 == len(letters) || next(i, "NED") && i+4 == len(letters)):
+			case (next(i, "I") || next(i, "E") || next(i, "Y")) && at(i-1) != 'G':
+				code.WriteByte('J')
+			default:
+				code.WriteByte('K')
+			}
+		case 'H':
+			afterVowel := isVowel(at(i - 1))
+			beforeVowel := isVowel(at(i + 1))
+			if !strings.ContainsRune("CSPTG", rune(at(i-1))) && !(afterVowel && !beforeVowel) {
+				code.WriteByte('H')
+			}
+		case 'K':
+			if at(i-1) != 'C' {
+				code.WriteByte('K')
+			}
+		case 'P':
+			if next(i, "H") {
+				code.WriteByte('F')
+			} else {
+				code.WriteByte('P')
+			}
+		case 'Q':
+			code.WriteByte('K')
+		case 'S':
+			if next(i, "H") || next(i, "IO") || next(i, "IA") {
+				code.WriteByte('X')
+			} else {
+				code.WriteByte('S')
+			}
+		case 'T':
+			switch {
+			case next(i, "IA") || next(i, "IO"):
+				code.WriteByte('X')
+			case next(i, "H"):
+				code.WriteByte('0')
+			case !next(i, "CH"):
+				code.WriteByte('T')
+			}
+		case 'V':
+			code.WriteByte('F')
+		case 'W', 'Y':
+			if isVowel(at(i + 1)) {
+				code.WriteByte(c)
+			}
+		case 'X':
+			code.WriteString("KS")
+		case 'Z':
+			code.WriteByte('S')
+		default:
+			// F, J, L, M, N and R
+			code.WriteByte(c)
+		}
+	}
+
+	return code.String()
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// similarity returns a value between 0 and 1 based on the edit
+// distance between the two strings
+func similarity(a, b string) float64 {
+	longest := max(utf8.RuneCountInString(a), utf8.RuneCountInString(b))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+// fuzzyKey is what we compare words on. Case, punctuation and spaces
+// do not matter.
+func fuzzyKey(text string) string {
+	return strings.Map(func(r rune) rune {
+		if isWordRune(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, text)
+}
+
+type fuzzyTerm struct {
+	canonical string
+	words     int
+	key       string
+	code      string
+}
+
+// fuzzyMatcher corrects words and n-grams in the transcript that sound
+// and look like dictionary entries to the dictionary spelling.
+type fuzzyMatcher struct {
+	terms     []fuzzyTerm
+	deny      map[string]struct{}
+	threshold float64
+}
+
+func newFuzzyMatcher(dictionary []string, allow, deny []string, threshold float64) *fuzzyMatcher {
+	m := &fuzzyMatcher{deny: map[string]struct{}{}, threshold: threshold}
+
+	allowed := map[string]struct{}{}
+	for _, entry := range allow {
+		allowed[fuzzyKey(entry)] = struct{}{}
+	}
+
+	for _, entry := range dictionary {
+		key := fuzzyKey(entry)
+		words := len(strings.Fields(entry))
+		if len(key) < minFuzzyTermLength || words > maxFuzzyWords {
+			continue
+		}
+
+		if _, found := allowed[key]; len(allowed) > 0 && !found {
+			continue
+		}
+
+		m.terms = append(m.terms, fuzzyTerm{
+			canonical: entry,
+			words:     words,
+			key:       key,
+			code:      metaphone(key),
+		})
+	}
+
+	for _, word := range deny {
+		m.deny[fuzzyKey(word)] = struct{}{}
+	}
+
+	return m
+}
+
+// score compares a candidate from the transcript with a dictionary
+// term. Both how they sound and how they are spelt are given equal
+// weight.
+func (t fuzzyTerm) score(key string) float64 {
+	return (similarity(metaphone(key), t.code) + similarity(key, t.key)) / 2
+}
+
+type fuzzyCorrection struct {
+	from, to string
+	score    float64
+}
+
+// correct returns the corrected text along with the list of
+// corrections that were made. Longer n-grams are matched first, and
+// words are only ever part of one correction.
+func (m *fuzzyMatcher) correct(text string) (string, []fuzzyCorrection) {
+	words := strings.Fields(text)
+	replaced := make([]string, len(words))
+	used := make([]bool, len(words))
+	var corrections []fuzzyCorrection
+
+	for n := maxFuzzyWords; n > 0; n-- {
+		for i := 0; i+n <= len(words); i++ {
+			span := words[i : i+n]
+			if slices.Contains(used[i:i+n], true) || m.denied(span) {
+				continue
+			}
+
+			key := fuzzyKey(strings.Join(span, ""))
+			if len(key) < minFuzzyLength {
+				continue
+			}
+
+			var best *fuzzyTerm
+			bestScore := m.threshold
+			for j, term := range m.terms {
+				// Allow an extra word either way as whisper tends to
+				// split up or merge unknown words
+				if term.words > n+1 || n > term.words+1 {
+					continue
+				}
+
+				if score := term.score(key); score >= bestScore {
+					best, bestScore = &m.terms[j], score
+				}
+			}
+
+			if best == nil {
+				continue
+			}
+
+			original := strings.Join(span, " ")
+			leading, trailing := punctuation(span[0], span[n-1])
+			correction := leading + best.canonical + trailing
+			for k := i; k < i+n; k++ {
+				used[k] = true
+			}
+			replaced[i] = correction
+
+			if correction != original {
+				corrections = append(corrections, fuzzyCorrection{from: original, to: correction, score: bestScore})
+			}
+		}
+	}
+
+	var out []string
+	for i, word := range words {
+		switch {
+		case replaced[i] != "":
+			out = append(out, replaced[i])
+		case !used[i]:
+			out = append(out, word)
+		}
+	}
+
+	return strings.Join(out, " "), corrections
+}
+
+func (m *fuzzyMatcher) denied(span []string) bool {
+	for _, word := range span {
+		if _, found := m.deny[fuzzyKey(word)]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// punctuation returns the punctuation before the first word and after
+// the last word so that it can be kept around a correction
+func punctuation(first, last string) (string, string) {
+	leading := first[:len(first)-len(strings.TrimLeftFunc(first, func(r rune) bool { return !isWordRune(r) }))]
+	trailing := last[len(strings.TrimRightFunc(last, func(r rune) bool { return !isWordRune(r) })):]
+	return leading, trailing
+}
@@ -9,6 +9,8 @@ require (
 	github.com/hajimehoshi/oto v1.0.1
 	github.com/manifoldco/promptui v0.9.0
 	github.com/micmonay/keybd_event v1.1.2
+	github.com/rivo/uniseg v0.4.7
+	github.com/sashabaranov/go-openai v1.36.1
 	github.com/schollz/progressbar/v3 v3.17.1
 	golang.design/x/hotkey v0.4.1
 	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f
@@ -18,8 +20,6 @@ require (
 require (
 	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
-	github.com/rivo/uniseg v0.4.7 // indirect
-	github.com/sashabaranov/go-openai v1.36.1 // indirect
 	golang.design/x/mainthread v0.3.0 // indirect
 	golang.org/x/exp/shiny v0.0.0-20241108190413-2d47ceb2692f // indirect
 	golang.org/x/image v0.14.0 // indirect
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/micmonay/keybd_event"
+)
+
+// Backends used to send keys to the focused application
+const (
+	backendAuto    = "auto"
+	backendNative  = "native"
+	backendWtype   = "wtype"
+	backendYdotool = "ydotool"
+)
+
+// What to do about modifier keys that are still held down (like the
+// ones of the hotkey) when sending keys. Keys sent while they are held
+// would trigger shortcuts instead.
+const (
+	modifiersWait    = "wait"
+	modifiersRelease = "release"
+	modifiersIgnore  = "ignore"
+)
+
+// keyboard sends key presses to the focused application
+type keyboard interface {
+	// tap presses and releases the chord the given number of times
+	tap(c chord, times int) error
+
+	// release sends key up events for the modifier keys
+	release() error
+}
+
+// textKeyboard is a keyboard that can type out text by itself, without
+// going through the keyboard layout
+type textKeyboard interface {
+	keyboard
+
+	// canType reports if typeText can type the character
+	canType(char rune) bool
+	typeText(text string) error
+}
+
+// nativeKeyboard sends key presses using keybd_event
+type nativeKeyboard struct{ kb keybd_event.KeyBonding }
+
+func (k nativeKeyboard) tap(c chord, times int) error {
+	kb := k.kb
+	kb.Clear()
+	kb.HasCTRL(c.ctrl)
+	kb.HasSHIFT(c.shift)
+	kb.HasALT(c.alt)
+	kb.HasSuper(c.super)
+	if c.altgr {
+		setAltGr(&kb)
+	}
+	kb.SetKeys(c.key)
+
+	for i := 0; i < times; i++ {
+		// kb.Launching is slow
+		err := kb.Press()
+		if err != nil {
+			return err
+		}
+		err = kb.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k nativeKeyboard) release() error {
+	return releaseModifiers(k.kb)
+}
+
+// keyboardOutput has what the paste and type outputs need to send
+// text to the focused application
+type keyboardOutput struct {
+	keyboard keyboard
+	layout   keyboardLayout
+	paste    *pasteChords
+
+	// Selection to paste through and how it is restored
+	selection     selection
+	restoreDelay  time.Duration
+	keepClipboard bool
+
+	// What to do about held modifier keys, and how long to wait for
+	// them to be let go
+	heldModifiers   string
+	modifierTimeout time.Duration
+}
+
+func newKeyboardOutput(config *Config, kb keybd_event.KeyBonding) (*keyboardOutput, error) {
+	layout, err := loadKeyboardLayout(config.KeyboardLayout)
+	if err != nil {
+		return nil, err
+	}
+
+	paste, err := newPasteChords(config, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &keyboardOutput{
+		keyboard:      nativeKeyboard{kb: kb},
+		layout:        layout,
+		paste:         paste,
+		selection:     selection{name: config.ClipboardSelection},
+		restoreDelay:  max(config.ClipboardRestoreDelay, 0),
+		keepClipboard: config.KeepClipboard,
+
+		heldModifiers:   config.HeldModifiers,
+		modifierTimeout: config.ModifierTimeout,
+	}
+
+	// Only check for the tools when something is going to use them
+	if !hasOutput(config, sinkPaste) && !hasOutput(config, sinkType) {
+		return keys, nil
+	}
+
+	backend, err := resolveBackend(config.OutputBackend)
+	if err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case backendWtype:
+		keys.keyboard = wtypeKeyboard{}
+	case backendYdotool:
+		keys.keyboard = ydotoolKeyboard{}
+		if config.KeyboardLayout == "us" {
+			keys.keyboard = ydotoolTextKeyboard{}
+		}
+	}
+
+	if backend != backendNative && os.Getenv("WAYLAND_DISPLAY") != "" {
+		err = checkTools("pasting on Wayland needs %s from wl-clipboard", "wl-copy", "wl-paste")
+		if err != nil {
+			return nil, err
+		}
+		keys.selection.wayland = true
+	}
+
+	return keys, nil
+}
+
+// tap presses a key by name, like enter or cmd+a
+func (k *keyboardOutput) tap(name string, times int) error {
+	if times <= 0 {
+		return nil
+	}
+
+	c, err := parseChord(name, k.layout)
+	if err != nil {
+		return err
+	}
+
+	err = k.ready()
+	if err != nil {
+		return err
+	}
+	return k.keyboard.tap(c, times)
+}
+
+// ready makes sure no modifier keys are held down before we send keys,
+// either by waiting for them to be let go or by releasing them. If we
+// cannot tell whether they are held, they are released.
+func (k *keyboardOutput) ready() error {
+	switch k.heldModifiers {
+	case modifiersIgnore:
+		return nil
+	case modifiersRelease:
+		return k.keyboard.release()
+	}
+
+	deadline := time.Now().Add(k.modifierTimeout)
+	for {
+		held, err := heldModifiers()
+		if err != nil {
+			return k.keyboard.release()
+		}
+		if !held {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("modifier keys are still held down after %s", k.modifierTimeout)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// resolveBackend picks the backend to send keys with. Wayland does not
+// let us send keys the usual way, so we go through wtype or ydotool
+// there, whichever is installed.
+func resolveBackend(backend string) (string, error) {
+	switch backend {
+	case backendNative:
+		return backendNative, nil
+	case backendWtype, backendYdotool:
+		return backend, checkTools("output_backend "+backend+" needs %s to be installed", backend)
+	case backendAuto:
+	default:
+		return "", fmt.Errorf("unknown output_backend '%s'", backend)
+	}
+
+	if os.Getenv("WAYLAND_DISPLAY") == "" {
+		return backendNative, nil
+	}
+
+	for _, tool := range []string{backendWtype, backendYdotool} {
+		if checkTools("%s", tool) == nil {
+			return tool, nil
+		}
+	}
+	return "", fmt.Errorf("sending keys on Wayland needs wtype or ydotool to be installed, " +
+		"set output_backend to native to use the X11 way instead")
+}
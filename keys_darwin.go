@@ -0,0 +1,34 @@
+package main
+
+import "github.com/micmonay/keybd_event"
+
+// The key labelled delete on a mac keyboard
+const keyBackspace = keybd_event.VK_DELETE
+
+// Modifier for shortcuts like select all
+const shortcutModifier = "cmd"
+
+// Option is what AltGr is on a mac
+func setAltGr(kb *keybd_event.KeyBonding) {
+	kb.HasALT(true)
+}
+
+// Key codes for the keys in keyRows that are not letters or digits
+var symbolKeys = map[string]int{
+	"grave":        keybd_event.VK_GRAVE,
+	"minus":        keybd_event.VK_MINUS,
+	"equal":        keybd_event.VK_EQUAL,
+	"leftbracket":  keybd_event.VK_LeftBracket,
+	"rightbracket": keybd_event.VK_RightBracket,
+	"backslash":    keybd_event.VK_BACKSLASH,
+	"semicolon":    keybd_event.VK_SEMICOLON,
+	"quote":        keybd_event.VK_Quote,
+	"iso":          keybd_event.VK_SP1,
+	"comma":        keybd_event.VK_COMMA,
+	"period":       keybd_event.VK_Period,
+	"slash":        keybd_event.VK_SLASH,
+}
+
+const defaultPasteChord = "cmd+v"
+
+var defaultAppPasteChords []AppPasteChord
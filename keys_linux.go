@@ -0,0 +1,40 @@
+package main
+
+import "github.com/micmonay/keybd_event"
+
+const keyBackspace = keybd_event.VK_BACKSPACE
+
+const shortcutModifier = "ctrl"
+
+func setAltGr(kb *keybd_event.KeyBonding) {
+	kb.HasALTGR(true)
+}
+
+var symbolKeys = map[string]int{
+	"grave":        keybd_event.VK_GRAVE,
+	"minus":        keybd_event.VK_MINUS,
+	"equal":        keybd_event.VK_EQUAL,
+	"leftbracket":  keybd_event.VK_LEFTBRACE,
+	"rightbracket": keybd_event.VK_RIGHTBRACE,
+	"backslash":    keybd_event.VK_BACKSLASH,
+	"semicolon":    keybd_event.VK_SEMICOLON,
+	"quote":        keybd_event.VK_APOSTROPHE,
+	"iso":          keybd_event.VK_102ND,
+	"comma":        keybd_event.VK_COMMA,
+	"period":       keybd_event.VK_DOT,
+	"slash":        keybd_event.VK_SLASH,
+
+	// For pasting the primary selection with shift+insert
+	"insert": keybd_event.VK_INSERT,
+}
+
+const defaultPasteChord = "ctrl+v"
+
+// Terminals use ctrl+shift+v as ctrl+v is passed on to the program
+// running in them
+var defaultAppPasteChords = []AppPasteChord{{
+	Class: "^(gnome-terminal.*|org\\.gnome\\.console|kgx|konsole|kitty|alacritty|foot|footclient|" +
+		"org\\.wezfurlong\\.wezterm|wezterm.*|tilix|terminator|xfce4-terminal|lxterminal|" +
+		"mate-terminal|ghostty|com\\.mitchellh\\.ghostty|terminology|sakura)$",
+	Chord: "ctrl+shift+v",
+}}
@@ -0,0 +1,34 @@
+package main
+
+import "github.com/micmonay/keybd_event"
+
+const keyBackspace = keybd_event.VK_BACK
+
+const shortcutModifier = "ctrl"
+
+func setAltGr(kb *keybd_event.KeyBonding) {
+	kb.HasALTGR(true)
+}
+
+// Scan codes, as the VK_OEM keys move around between layouts
+var symbolKeys = map[string]int{
+	"grave":        keybd_event.VK_SP1,
+	"minus":        keybd_event.VK_SP2,
+	"equal":        keybd_event.VK_SP3,
+	"leftbracket":  keybd_event.VK_SP4,
+	"rightbracket": keybd_event.VK_SP5,
+	"semicolon":    keybd_event.VK_SP6,
+	"quote":        keybd_event.VK_SP7,
+	"backslash":    keybd_event.VK_SP8,
+	"comma":        keybd_event.VK_SP9,
+	"period":       keybd_event.VK_SP10,
+	"slash":        keybd_event.VK_SP11,
+	"iso":          keybd_event.VK_SP12,
+
+	// For pasting the primary selection with shift+insert
+	"insert": keybd_event.VK_INSERT,
+}
+
+const defaultPasteChord = "ctrl+v"
+
+var defaultAppPasteChords []AppPasteChord
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/micmonay/keybd_event"
+)
+
+// keyStroke is how a character is typed on a layout
+type keyStroke struct {
+	key   int
+	shift bool
+	altgr bool
+}
+
+// keyboardLayout maps characters to the keys that type them
+type keyboardLayout map[rune]keyStroke
+
+// Physical keys in the rows of a keyboard, named after what they type
+// on a US layout. iso is the extra key next to the left shift on ISO
+// keyboards.
+var keyRows = [4][]string{
+	{"grave", "1", "2", "3", "4", "5", "6", "7", "8", "9", "0", "minus", "equal"},
+	{"q", "w", "e", "r", "t", "y", "u", "i", "o", "p", "leftbracket", "rightbracket", "backslash"},
+	{"a", "s", "d", "f", "g", "h", "j", "k", "l", "semicolon", "quote"},
+	{"iso", "z", "x", "c", "v", "b", "n", "m", "comma", "period", "slash"},
+}
+
+// layoutRows describes a layout by what each key in keyRows types,
+// without and with shift. A space means the key does not type anything
+// useful (like a dead key). altgr has the characters typed with AltGr
+// along with the key for them.
+type layoutRows struct {
+	base  [4]string
+	shift [4]string
+	altgr map[rune]string
+}
+
+// Built-in layouts. The AZERTY and QWERTZ layouts are the PC (Windows
+// and Linux) variants. The Mac variants have many of the symbols on
+// other keys and need a layout file.
+var builtinLayouts = map[string]layoutRows{
+	"us": {
+		base:  [4]string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", " zxcvbnm,./"},
+		shift: [4]string{"~!@#$%^&*()_+", "QWERTYUIOP{}|", "ASDFGHJKL:\"", " ZXCVBNM<>?"},
+	},
+	"azerty": {
+		base:  [4]string{"²&é\"'(-è_çà)=", "azertyuiop $*", "qsdfghjklmù", "<wxcvbn,;:!"},
+		shift: [4]string{" 1234567890°+", "AZERTYUIOP £µ", "QSDFGHJKLM%", ">WXCVBN?./§"},
+		altgr: map[rune]string{
+			'#': "3", '{': "4", '[': "5", '|': "6", '\\': "8", '^': "9", '@': "0",
+			']': "minus", '}': "equal", '€': "e", '¤': "rightbracket",
+		},
+	},
+	"qwertz": {
+		base:  [4]string{" 1234567890ß ", "qwertzuiopü+#", "asdfghjklöä", "<yxcvbnm,.-"},
+		shift: [4]string{"°!\"§$%&/()=? ", "QWERTZUIOPÜ*'", "ASDFGHJKLÖÄ", ">YXCVBNM;:_"},
+		altgr: map[rune]string{
+			'²': "2", '³': "3", '{': "7", '[': "8", ']': "9", '}': "0", '\\': "minus",
+			'@': "q", '€': "e", '~': "rightbracket", '|': "iso", 'µ': "m",
+		},
+	},
+	"dvorak": {
+		base:  [4]string{"`1234567890[]", "',.pyfgcrl/=\\", "aoeuidhtns-", " ;qjkxbmwvz"},
+		shift: [4]string{"~!@#$%^&*(){}", "\"<>PYFGCRL?+|", "AOEUIDHTNS_", " :QJKXBMWVZ"},
+	},
+}
+
+// keyCode returns the key code for a physical key name
+func keyCode(name string) (int, bool) {
+	if len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= '0' && name[0] <= '9') {
+		return letterKeys[name[0]], true
+	}
+
+	switch name {
+	case "space":
+		return keybd_event.VK_SPACE, true
+	case "enter":
+		return keybd_event.VK_ENTER, true
+	case "tab":
+		return keybd_event.VK_TAB, true
+	case "backspace":
+		return keyBackspace, true
+	}
+
+	code, found := symbolKeys[name]
+	return code, found
+}
+
+var letterKeys = map[byte]int{
+	'a': keybd_event.VK_A, 'b': keybd_event.VK_B, 'c': keybd_event.VK_C, 'd': keybd_event.VK_D,
+	'e': keybd_event.VK_E, 'f': keybd_event.VK_F, 'g': keybd_event.VK_G, 'h': keybd_event.VK_H,
+	'i': keybd_event.VK_I, 'j': keybd_event.VK_J, 'k': keybd_event.VK_K, 'l': keybd_event.VK_L,
+	'm': keybd_event.VK_M, 'n': keybd_event.VK_N, 'o': keybd_event.VK_O, 'p': keybd_event.VK_P,
+	'q': keybd_event.VK_Q, 'r': keybd_event.VK_R, 's': keybd_event.VK_S, 't': keybd_event.VK_T,
+	'u': keybd_event.VK_U, 'v': keybd_event.VK_V, 'w': keybd_event.VK_W, 'x': keybd_event.VK_X,
+	'y': keybd_event.VK_Y, 'z': keybd_event.VK_Z,
+	'1': keybd_event.VK_1, '2': keybd_event.VK_2, '3': keybd_event.VK_3, '4': keybd_event.VK_4,
+	'5': keybd_event.VK_5, '6': keybd_event.VK_6, '7': keybd_event.VK_7, '8': keybd_event.VK_8,
+	'9': keybd_event.VK_9, '0': keybd_event.VK_0,
+}
+
+func (rows layoutRows) layout() keyboardLayout {
+	layout := keyboardLayout{
+		' ':  {key: keybd_event.VK_SPACE},
+		'\n': {key: keybd_event.VK_ENTER},
+		'\t': {key: keybd_event.VK_TAB},
+	}
+
+	for r, keys := range keyRows {
+		for shift, row := range [2]string{rows.base[r], rows.shift[r]} {
+			for i, char := range []rune(row) {
+				if char == ' ' || i >= len(keys) {
+					continue
+				}
+
+				code, found := keyCode(keys[i])
+				if _, exists := layout[char]; found && !exists {
+					layout[char] = keyStroke{key: code, shift: shift == 1}
+				}
+			}
+		}
+	}
+
+	for char, key := range rows.altgr {
+		if code, found := keyCode(key); found {
+			layout[char] = keyStroke{key: code, altgr: true}
+		}
+	}
+
+	return layout
+}
+
+// parseLayout parses a layout file. Each line has a character followed
+// by the key that types it and optionally the modifiers, like
+// `@ 0+altgr` or `A q+shift`. A `base <layout>` line starts off from
+// one of the built-in layouts. Lines starting with // are ignored.
+func parseLayout(data string) (keyboardLayout, error) {
+	layout := builtinLayouts["us"].layout()
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		if name, found := strings.CutPrefix(line, "base "); found {
+			rows, found := builtinLayouts[strings.TrimSpace(name)]
+			if !found {
+				return nil, fmt.Errorf("line %d: unknown layout '%s'", i+1, strings.TrimSpace(name))
+			}
+			layout = rows.layout()
+			continue
+		}
+
+		char, size := utf8.DecodeRuneInString(line)
+		fields := strings.Fields(line[size:])
+		if len(fields) != 1 || !strings.ContainsAny(line[size:size+1], " \t") {
+			return nil, fmt.Errorf("line %d: expected '<character> <key>[+shift][+altgr]'", i+1)
+		}
+
+		parts := strings.Split(fields[0], "+")
+		code, found := keyCode(parts[0])
+		if !found {
+			return nil, fmt.Errorf("line %d: unknown key '%s'", i+1, parts[0])
+		}
+
+		stroke := keyStroke{key: code}
+		for _, modifier := range parts[1:] {
+			switch modifier {
+			case "shift":
+				stroke.shift = true
+			case "altgr":
+				stroke.altgr = true
+			default:
+				return nil, fmt.Errorf("line %d: unknown modifier '%s'", i+1, modifier)
+			}
+		}
+		layout[char] = stroke
+	}
+
+	return layout, nil
+}
+
+// loadKeyboardLayout returns one of the built-in layouts or reads the
+// layout from a file
+func loadKeyboardLayout(name string) (keyboardLayout, error) {
+	if rows, found := builtinLayouts[name]; found {
+		return rows.layout(), nil
+	}
+
+	data, err := os.ReadFile(sinkPath(name))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keyboard layout: %w", err)
+	}
+
+	layout, err := parseLayout(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return layout, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/sashabaranov/go-openai"
+)
+
+// What to do with the raw transcript when LLM post-processing fails
+const (
+	llmFallbackPaste     = "paste"
+	llmFallbackClipboard = "clipboard"
+	llmFallbackDrop      = "drop"
+)
+
+const defaultSystemPrompt = "Cleanup the following transcript and add punctuation. Do not change anything else."
+
+func newLLMConfig(config *Config) (openai.ClientConfig, string, error) {
+	apiKey := os.Getenv("OJUT_LLM_API_KEY")
+	if len(apiKey) == 0 {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+		if len(apiKey) == 0 {
+			return openai.ClientConfig{}, "", fmt.Errorf("neither OJUT_LLM_API_KEY nor OPENAI_API_KEY environment variables are set")
+		}
+	}
+
+	llmConfig := openai.DefaultConfig(apiKey)
+
+	// Use configured base URL if available, otherwise check env var
+	if config.LLMBaseURL != "" {
+		llmConfig.BaseURL = config.LLMBaseURL
+	} else if apiURL := os.Getenv("OJUT_LLM_ENDPOINT"); len(apiURL) > 0 {
+		llmConfig.BaseURL = apiURL
+	}
+
+	// Get LLM model name
+	model := config.LLMModel
+	if len(model) == 0 {
+		model = os.Getenv("OJUT_LLM_MODEL")
+		if len(model) == 0 {
+			model = "gpt-4o-mini"
+		}
+	}
+
+	return llmConfig, model, nil
+}
+
+// streamFromLLM pastes the response from the LLM as it streams in,
+// grouped into chunks as configured. It returns the text it has pasted,
+// even on failure, so that the caller knows how much of the output
+// already made it out.
+func streamFromLLM(
+	ctx context.Context,
+	config *Config,
+	text, systemPrompt string,
+	out *output,
+	llmConfig openai.ClientConfig,
+	model string,
+) (string, error) {
+	client := openai.NewClientWithConfig(llmConfig)
+
+	stream, err := client.CreateChatCompletionStream(
+		ctx,
+		openai.ChatCompletionRequest{
+			Model: model,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleSystem,
+					Content: systemPrompt,
+				},
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: text,
+				},
+			},
+			Stream: true,
+		})
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var pasted strings.Builder
+	send := func(chunk string) error {
+		if len(chunk) == 0 {
+			return nil
+		}
+
+		var err error
+		if pasted.Len() == 0 {
+			err = out.insert(chunk)
+		} else {
+			err = out.extend(chunk)
+		}
+		if err != nil {
+			return err
+		}
+		pasted.WriteString(chunk)
+		return nil
+	}
+
+	chunks := newChunker(config)
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Whatever came in before the failure still goes out
+			err = errors.Join(err, send(chunks.flush()))
+			return pasted.String(), err
+		}
+
+		if len(response.Choices) > 0 {
+			err = send(chunks.add(response.Choices[0].Delta.Content))
+			if err != nil {
+				return pasted.String(), err
+			}
+		}
+	}
+
+	err = send(chunks.flush())
+	return pasted.String(), err
+}
+
+// isTransientLLMError reports if retrying the request could help
+func isTransientLLMError(err error) bool {
+	statusCode := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	if errors.As(err, &apiErr) {
+		statusCode = apiErr.HTTPStatusCode
+	} else if errors.As(err, &reqErr) {
+		statusCode = reqErr.HTTPStatusCode
+	}
+
+	if statusCode != 0 {
+		return statusCode == http.StatusTooManyRequests || statusCode >= 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// streamWithRetries retries transient errors with backoff as long as
+// nothing has been pasted yet. We cannot take back what was already
+// pasted, so retrying after that would end up duplicating text.
+func streamWithRetries(
+	ctx context.Context,
+	config *Config,
+	text, systemPrompt string,
+	out *output,
+	llmConfig openai.ClientConfig,
+	model string,
+) (string, error) {
+	for attempt := 0; ; attempt++ {
+		pasted, err := streamFromLLM(ctx, config, text, systemPrompt, out, llmConfig, model)
+		if err == nil || len(pasted) > 0 ||
+			attempt >= config.LLMRetries || !isTransientLLMError(err) {
+			return pasted, err
+		}
+
+		backoff := time.Duration(1<<attempt) * 500 * time.Millisecond
+		fmt.Fprintf(os.Stderr, "LLM request failed (%s), retrying in %s\n", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// postProcess runs the transcript through the LLM and pastes the
+// result. If that fails, the configured fallback is applied to the
+// raw transcript so that the dictation is not lost.
+func postProcess(ctx context.Context, config *Config, text string, out *output) {
+	systemPrompt := config.LLMSystemPrompt
+	if len(systemPrompt) == 0 {
+		systemPrompt = defaultSystemPrompt
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.LLMTimeout)
+	defer cancel()
+
+	var pasted string
+	llmConfig, model, err := newLLMConfig(config)
+	if err == nil {
+		pasted, err = streamWithRetries(ctx, config, text, systemPrompt, out, llmConfig, model)
+		if err == nil {
+			return
+		}
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		fmt.Fprintf(os.Stderr, "LLM post-processing timed out after %s\n", config.LLMTimeout)
+	} else {
+		fmt.Fprintf(os.Stderr, "Failed to stream from LLM: %s\n", err)
+	}
+
+	fallback := config.LLMFallback
+	if len(pasted) > 0 && fallback == llmFallbackPaste {
+		// Part of the processed text is already out. Pasting the raw
+		// transcript now would repeat it, so leave it on the
+		// clipboard for the user to fix things up.
+		fmt.Fprintf(os.Stderr, "Stream failed after pasting %d characters\n", len(pasted))
+		fallback = llmFallbackClipboard
+	}
+
+	switch fallback {
+	case llmFallbackPaste:
+		fmt.Fprintf(os.Stderr, "Pasting raw transcript instead\n")
+		err = out.insert(text)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to paste text: %s\n", err)
+		}
+	case llmFallbackClipboard:
+		fmt.Fprintf(os.Stderr, "Raw transcript copied to clipboard\n")
+		err = clipboard.WriteAll(text)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to copy text: %s\n", err)
+		}
+	case llmFallbackDrop:
+		fmt.Fprintf(os.Stderr, "Dropping transcript\n")
+	}
+}
@@ -1,15 +1,11 @@
 // TODO
-// - Pipe output to model as we speak (whisper streaming)
 // - Maybe a UI
 // - Maybe a way to track all the recordings so far (not sure what the use is)
 
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -17,9 +13,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
-
-	"github.com/sashabaranov/go-openai"
+	"time"
 
 	"github.com/gordonklaus/portaudio"
 	"github.com/micmonay/keybd_event"
@@ -38,9 +34,72 @@ var whisperBinary = func() string {
 }()
 
 type Config struct {
+	// Name of the profile to use
+	Profile string `yaml:"profile" json:"profile"`
+
+	// Named sets of settings that override the ones in the config
+	// when the profile is active
+	Profiles map[string]yaml.Node `yaml:"profiles" json:"-"`
+
 	// Name of the whisper model to use
 	Model string `yaml:"model" json:"model"`
 
+	// Model to re-transcribe the last dictation with on request.
+	// Defaults to the escalation model.
+	RetryModel string `yaml:"retry_model" json:"retry_model"`
+
+	// Bigger whisper model to re-run the audio with when the primary
+	// model is not confident about its result
+	EscalationModel string `yaml:"escalation_model" json:"escalation_model"`
+
+	// Average segment confidence (0-1) below which we escalate
+	EscalationThreshold float64 `yaml:"escalation_threshold" json:"escalation_threshold"`
+
+	// Keep non-speech annotations like [Music] or (keyboard clicking)
+	KeepAnnotations bool `yaml:"keep_annotations" json:"keep_annotations"`
+
+	// Phrases that whisper makes up on silent audio, in addition to
+	// the built-in list
+	HallucinationPhrases []string `yaml:"hallucination_phrases" json:"hallucination_phrases"`
+
+	// What to do with hallucinations on mostly silent audio (drop or flag)
+	HallucinationAction string `yaml:"hallucination_action" json:"hallucination_action"`
+
+	// Additional dictionary files, relative to the config directory
+	DictionaryFiles []string `yaml:"dictionary_files" json:"dictionary_files"`
+
+	// Maximum number of tokens to use for the whisper prompt
+	PromptTokenBudget int `yaml:"prompt_token_budget" json:"prompt_token_budget"`
+
+	// How much of the previous transcripts (in terms of audio
+	// duration) to pass on to whisper as context. Disabled if zero.
+	ContextDuration time.Duration `yaml:"context_duration" json:"context_duration"`
+
+	// Idle time after which we stop passing on previous transcripts
+	ContextResetAfter time.Duration `yaml:"context_reset_after" json:"context_reset_after"`
+
+	// Correct words that sound and look like dictionary entries to
+	// their dictionary spelling
+	FuzzyCorrection bool `yaml:"fuzzy_correction" json:"fuzzy_correction"`
+
+	// Minimum similarity (0-1) for a word to be corrected
+	FuzzyThreshold float64 `yaml:"fuzzy_threshold" json:"fuzzy_threshold"`
+
+	// Dictionary entries to correct towards. Defaults to all of them.
+	FuzzyAllow []string `yaml:"fuzzy_allow" json:"fuzzy_allow"`
+
+	// Words that should never be corrected
+	FuzzyDeny []string `yaml:"fuzzy_deny" json:"fuzzy_deny"`
+
+	// Maximum time a single whisper run is allowed to take
+	WhisperTimeout time.Duration `yaml:"whisper_timeout" json:"whisper_timeout"`
+
+	// Transcribe and type out text while we are still speaking
+	Streaming bool `yaml:"streaming" json:"streaming"`
+
+	// How often to transcribe the audio when streaming
+	StreamInterval time.Duration `yaml:"stream_interval" json:"stream_interval"`
+
 	// Whether to post-process text with LLM
 	PostProcess bool `yaml:"post_process" json:"post_process"`
 
@@ -52,6 +111,280 @@ type Config struct {
 
 	// Base URL for LLM API
 	LLMBaseURL string `yaml:"llm_base_url" json:"llm_base_url"`
+
+	// Maximum time LLM post-processing is allowed to take
+	LLMTimeout time.Duration `yaml:"llm_timeout" json:"llm_timeout"`
+
+	// Number of times to retry LLM requests that fail with transient
+	// errors. Set to -1 to disable retries.
+	LLMRetries int `yaml:"llm_retries" json:"llm_retries"`
+
+	// What to do with the raw transcript when post-processing fails
+	// (paste, clipboard or drop)
+	LLMFallback string `yaml:"llm_fallback" json:"llm_fallback"`
+
+	// How the streamed LLM output is grouped before sending it out
+	// (word, sentence, time or none)
+	LLMChunking string `yaml:"llm_chunking" json:"llm_chunking"`
+
+	// How often text is sent out with the time chunking
+	LLMChunkInterval time.Duration `yaml:"llm_chunk_interval" json:"llm_chunk_interval"`
+
+	// Dictations within this long of the previous one are treated as
+	// its continuation, adding a space in between and fixing up the
+	// case of the first letter. Set to -1s to disable.
+	ContinuityWindow time.Duration `yaml:"continuity_window" json:"continuity_window"`
+
+	// Convert spoken numbers, dates, times, currency and units into
+	// their written form (twenty three percent => 23%)
+	NormalizeText bool `yaml:"normalize_text" json:"normalize_text"`
+
+	// Convert spoken punctuation and symbol names (comma, open paren)
+	// into the characters
+	SymbolMode bool `yaml:"symbol_mode" json:"symbol_mode"`
+
+	// Phrase to start a dictation with to use symbol mode just for it
+	SymbolPrefix string `yaml:"symbol_prefix" json:"symbol_prefix"`
+
+	// Dictate code, with casing phrases (camel case user id), spoken
+	// literals and no auto-capitalization. Includes symbol mode.
+	CodeMode bool `yaml:"code_mode" json:"code_mode"`
+
+	// Language that is spoken (eg: en, de or auto to detect it). Also
+	// picks the spoken commands to use.
+	Language string `yaml:"language" json:"language"`
+
+	// Spoken commands per language, mapping a phrase to the action it
+	// triggers (enter, paragraph, tab, scratch or select_all). These
+	// are added to the built-in ones, use none to disable a phrase.
+	Commands map[string]map[string]string `yaml:"commands" json:"commands"`
+
+	// Type out command phrases instead of running them
+	LiteralMode bool `yaml:"literal_mode" json:"literal_mode"`
+
+	// Where the dictated text goes. Defaults to pasting it.
+	Outputs []OutputConfig `yaml:"outputs" json:"outputs"`
+
+	// Keyboard layout used by the type output (us, azerty, qwertz,
+	// dvorak or a layout file relative to the config directory)
+	KeyboardLayout string `yaml:"keyboard_layout" json:"keyboard_layout"`
+
+	// How keys are sent to the focused application (auto, native,
+	// wtype or ydotool). auto uses wtype or ydotool on Wayland.
+	OutputBackend string `yaml:"output_backend" json:"output_backend"`
+
+	// What to do about modifier keys that are still held down when
+	// sending keys (wait, release or ignore)
+	HeldModifiers string `yaml:"held_modifiers" json:"held_modifiers"`
+
+	// How long to wait for held modifier keys to be let go
+	ModifierTimeout time.Duration `yaml:"modifier_timeout" json:"modifier_timeout"`
+
+	// Key chord used to paste (eg: cmd+v, ctrl+shift+v). Defaults to
+	// cmd+v on macOS and ctrl+v elsewhere.
+	PasteChord string `yaml:"paste_chord" json:"paste_chord"`
+
+	// Paste chords for specific applications, picked by the class or
+	// title of the focused window
+	AppPasteChords []AppPasteChord `yaml:"app_paste_chords" json:"app_paste_chords"`
+
+	// How long to wait after pasting before restoring the clipboard.
+	// Negative values restore it right away.
+	ClipboardRestoreDelay time.Duration `yaml:"clipboard_restore_delay" json:"clipboard_restore_delay"`
+
+	// Leave the text on the clipboard after pasting it
+	KeepClipboard bool `yaml:"keep_clipboard" json:"keep_clipboard"`
+
+	// Paste through the clipboard or the X11 primary selection
+	// (clipboard or primary). Pasting from primary defaults to
+	// shift+insert.
+	ClipboardSelection string `yaml:"clipboard_selection" json:"clipboard_selection"`
+
+	// Number of dictations that can be undone
+	UndoLevels int `yaml:"undo_levels" json:"undo_levels"`
+
+	// Print out debug information, like the corrections that were made
+	Debug bool `yaml:"debug" json:"debug"`
+}
+
+// applyDefaults fills in the values that were not configured
+func (c *Config) applyDefaults() {
+	if c.EscalationThreshold <= 0 {
+		c.EscalationThreshold = 0.6
+	}
+	if c.WhisperTimeout <= 0 {
+		c.WhisperTimeout = time.Minute
+	}
+	if c.StreamInterval <= 0 {
+		c.StreamInterval = 2 * time.Second
+	}
+	if c.LLMTimeout <= 0 {
+		c.LLMTimeout = 30 * time.Second
+	}
+	if c.LLMRetries == 0 {
+		c.LLMRetries = 2
+	}
+	if c.LLMFallback == "" {
+		c.LLMFallback = llmFallbackPaste
+	}
+	if c.LLMChunking == "" {
+		c.LLMChunking = chunkSentence
+	}
+	if c.LLMChunkInterval <= 0 {
+		c.LLMChunkInterval = time.Second
+	}
+	if c.HallucinationAction == "" {
+		c.HallucinationAction = hallucinationDrop
+	}
+	if c.FuzzyThreshold <= 0 {
+		c.FuzzyThreshold = 0.8
+	}
+	if c.PromptTokenBudget <= 0 {
+		c.PromptTokenBudget = defaultPromptTokenBudget
+	}
+	if c.ContextResetAfter <= 0 {
+		c.ContextResetAfter = 2 * time.Minute
+	}
+	if len(c.Outputs) == 0 {
+		c.Outputs = []OutputConfig{{Type: sinkPaste}}
+	}
+	if c.UndoLevels <= 0 {
+		c.UndoLevels = 10
+	}
+	if c.ContinuityWindow == 0 {
+		c.ContinuityWindow = time.Minute
+	}
+	if c.SymbolPrefix == "" {
+		c.SymbolPrefix = defaultSymbolPrefix
+	}
+	if c.Language == "" {
+		c.Language = "en"
+	}
+	if c.KeyboardLayout == "" {
+		c.KeyboardLayout = "us"
+	}
+	if c.OutputBackend == "" {
+		c.OutputBackend = backendAuto
+	}
+	if c.HeldModifiers == "" {
+		c.HeldModifiers = modifiersWait
+	}
+	if c.ModifierTimeout <= 0 {
+		c.ModifierTimeout = 2 * time.Second
+	}
+	if c.ClipboardSelection == "" {
+		c.ClipboardSelection = selectionClipboard
+	}
+	if c.PasteChord == "" && c.ClipboardSelection == selectionPrimary {
+		c.PasteChord = "shift+insert"
+	}
+	if c.PasteChord == "" {
+		c.PasteChord = defaultPasteChord
+	}
+	if c.ClipboardRestoreDelay == 0 {
+		c.ClipboardRestoreDelay = 100 * time.Millisecond
+	}
+}
+
+// withProfile returns the config with the settings from the named
+// profile applied on top of it. Profiles can override any of the
+// settings in the config.
+func (c *Config) withProfile(name string) (*Config, error) {
+	if name == "" {
+		return c, nil
+	}
+
+	node, found := c.Profiles[name]
+	if !found {
+		return nil, fmt.Errorf("unknown profile '%s'", name)
+	}
+
+	profile := *c
+	err := node.Decode(&profile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile '%s': %w", name, err)
+	}
+
+	profile.Profile = name
+	profile.Profiles = c.Profiles
+	return &profile, nil
+}
+
+func (c *Config) validate() error {
+	if c.EscalationThreshold > 1 {
+		return fmt.Errorf("escalation_threshold should be between 0 and 1")
+	}
+	if c.FuzzyThreshold > 1 {
+		return fmt.Errorf("fuzzy_threshold should be between 0 and 1")
+	}
+
+	switch c.LLMFallback {
+	case llmFallbackPaste, llmFallbackClipboard, llmFallbackDrop:
+	default:
+		return fmt.Errorf("unknown llm_fallback '%s'", c.LLMFallback)
+	}
+
+	switch c.OutputBackend {
+	case backendAuto, backendNative:
+	case backendWtype, backendYdotool:
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("output_backend %s is only available on Linux", c.OutputBackend)
+		}
+	default:
+		return fmt.Errorf("unknown output_backend '%s'", c.OutputBackend)
+	}
+
+	switch c.HeldModifiers {
+	case modifiersWait, modifiersRelease, modifiersIgnore:
+	default:
+		return fmt.Errorf("unknown held_modifiers '%s'", c.HeldModifiers)
+	}
+
+	switch c.ClipboardSelection {
+	case selectionClipboard:
+	case selectionPrimary:
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("clipboard_selection primary is only available on Linux")
+		}
+	default:
+		return fmt.Errorf("unknown clipboard_selection '%s'", c.ClipboardSelection)
+	}
+
+	switch c.LLMChunking {
+	case chunkNone, chunkWord, chunkSentence, chunkTime:
+	default:
+		return fmt.Errorf("unknown llm_chunking '%s'", c.LLMChunking)
+	}
+
+	switch c.HallucinationAction {
+	case hallucinationDrop, hallucinationFlag:
+	default:
+		return fmt.Errorf("unknown hallucination_action '%s'", c.HallucinationAction)
+	}
+
+	keys, err := newKeyboardOutput(c, keybd_event.KeyBonding{})
+	if err != nil {
+		return err
+	}
+
+	for _, output := range c.Outputs {
+		if _, err := newSink(output, keys); err != nil {
+			return err
+		}
+	}
+
+	return validateCommands(c.Commands)
+}
+
+func debugf(config *Config, format string, args ...any) {
+	if config.Debug {
+		fmt.Fprintf(os.Stderr, "[debug] "+format+"\n", args...)
+	}
+}
+
+// configPath returns the path to a file in the ojut config directory
+func configPath(name string) string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "ojut", name)
 }
 
 func readDictionaryFile(filePath string) ([]string, error) {
@@ -115,74 +448,54 @@ func readConfigFromFile(filePath string) (*Config, error) {
 	return &config, nil
 }
 
-func streamFromLLM(
-	text, systemPrompt string,
-	kb keybd_event.KeyBonding,
-	llmConfig openai.ClientConfig,
-	model string,
-) error {
-	client := openai.NewClientWithConfig(llmConfig)
-
-	stream, err := client.CreateChatCompletionStream(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: systemPrompt,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: text,
-				},
-			},
-			Stream: true,
-		})
-	if err != nil {
-		return err
-	}
-	defer stream.Close()
-
-	for {
-		response, err := stream.Recv()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		if len(response.Choices) > 0 {
-			content := response.Choices[0].Delta.Content
-			if len(content) > 0 {
-				err = pasteString(content, kb)
-				if err != nil {
-					return err
-				}
-			}
-		}
-	}
-
-	return nil
-}
-
-func overrideConfigWithCLIArgs(config *Config) *Config {
+// parseCLIArgs parses the CLI args into a config which only has the
+// values that were passed in set
+func parseCLIArgs() *Config {
 	cliConfig := &Config{}
 	var listModelsFlag bool
 
+	flag.StringVar(
+		&cliConfig.Profile, "profile",
+		"", "Name of the profile to use")
 	flag.StringVar(
 		&cliConfig.Model, "model",
 		"", "Name of the whisper model to use")
+	flag.StringVar(
+		&cliConfig.EscalationModel, "escalation-model",
+		"", "Name of the whisper model to use when confidence is low")
+	flag.DurationVar(
+		&cliConfig.WhisperTimeout, "whisper-timeout",
+		0, "Maximum time a whisper run is allowed to take")
 	flag.StringVar(
 		&cliConfig.LLMModel, "llm-model",
 		"", "Name of the LLM model to use for post-processing")
 	flag.StringVar(
 		&cliConfig.LLMBaseURL, "llm-base-url",
 		"", "Base URL for LLM API")
+	flag.DurationVar(
+		&cliConfig.LLMTimeout, "llm-timeout",
+		0, "Maximum time LLM post-processing is allowed to take")
 	flag.BoolVar(
 		&cliConfig.PostProcess, "post-process",
 		false, "Whether to post-process text with LLM")
+	flag.BoolVar(
+		&cliConfig.Streaming, "streaming",
+		false, "Type out text while still speaking")
+	flag.StringVar(
+		&cliConfig.Language, "language",
+		"", "Language that is spoken (eg: en, de or auto)")
+	flag.BoolVar(
+		&cliConfig.SymbolMode, "symbol-mode",
+		false, "Convert spoken punctuation and symbol names into characters")
+	flag.BoolVar(
+		&cliConfig.CodeMode, "code-mode",
+		false, "Dictate code, with casing phrases and spoken literals")
+	flag.BoolVar(
+		&cliConfig.LiteralMode, "literal",
+		false, "Type out command phrases instead of running them")
+	flag.BoolVar(
+		&cliConfig.Debug, "debug",
+		false, "Print out debug information")
 	flag.BoolVar(
 		&listModelsFlag, "list-models",
 		false, "List available models and exit")
@@ -198,25 +511,66 @@ func overrideConfigWithCLIArgs(config *Config) *Config {
 		os.Exit(0)
 	}
 
+	return cliConfig
+}
+
+func overrideConfigWithCLIArgs(config *Config, cliConfig *Config) *Config {
 	// Override config with CLI args only if they are set
 	if cliConfig.Model != "" {
 		config.Model = cliConfig.Model
 	}
+	if cliConfig.EscalationModel != "" {
+		config.EscalationModel = cliConfig.EscalationModel
+	}
+	if cliConfig.WhisperTimeout != 0 {
+		config.WhisperTimeout = cliConfig.WhisperTimeout
+	}
 
 	if cliConfig.PostProcess {
 		config.PostProcess = cliConfig.PostProcess
 	}
+	if cliConfig.Streaming {
+		config.Streaming = cliConfig.Streaming
+	}
+	if cliConfig.Language != "" {
+		config.Language = cliConfig.Language
+	}
+	if cliConfig.SymbolMode {
+		config.SymbolMode = cliConfig.SymbolMode
+	}
+	if cliConfig.CodeMode {
+		config.CodeMode = cliConfig.CodeMode
+	}
+	if cliConfig.LiteralMode {
+		config.LiteralMode = cliConfig.LiteralMode
+	}
+	if cliConfig.Debug {
+		config.Debug = cliConfig.Debug
+	}
 	if cliConfig.LLMModel != "" {
 		config.LLMModel = cliConfig.LLMModel
 	}
 	if cliConfig.LLMBaseURL != "" {
 		config.LLMBaseURL = cliConfig.LLMBaseURL
 	}
+	if cliConfig.LLMTimeout != 0 {
+		config.LLMTimeout = cliConfig.LLMTimeout
+	}
 
 	return config
 }
 
-func main() { mainthread.Init(fn) }
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replace" {
+		os.Exit(replaceCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(ctlCommand(os.Args[2:]))
+	}
+
+	mainthread.Init(fn)
+}
+
 func fn() {
 	_, err := exec.LookPath(whisperBinary)
 	if err != nil {
@@ -224,23 +578,18 @@ func fn() {
 		return
 	}
 
-	// Load config from file
-	configFilePath := filepath.Join(os.Getenv("HOME"), ".config", "ojut", "config.yaml")
-	config, err := readConfigFromFile(configFilePath)
+	// Load config from file and override with CLI args
+	cliConfig := parseCLIArgs()
+	configFilePath := configPath("config.yaml")
+	config, err := loadConfig(configFilePath, cliConfig)
 	if err != nil {
 		fmt.Printf("Error reading config file: %v\n", err)
 		return
 	}
 
-	// Override with CLI args
-	if config == nil {
-		config = &Config{}
-	}
-	config = overrideConfigWithCLIArgs(config)
-
-	modelFile, err := selectModel(config.Model)
+	active, err := resolveSettings(config, "")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to pick model: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		return
 	}
 
@@ -254,6 +603,28 @@ func fn() {
 		return
 	}
 
+	// The undo and retry hotkeys are optional, ojut ctl works without
+	// them
+	var undoKeys <-chan hotkey.Event
+	undoHk := hotkey.New([]hotkey.Modifier{hotkey.ModCtrl, hotkey.ModOption, hotkey.ModCmd}, hotkey.KeyZ)
+	err = undoHk.Register()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to register undo hotkey, use ojut ctl undo instead: %s\n", err)
+	} else {
+		undoKeys = undoHk.Keydown()
+		defer undoHk.Unregister()
+	}
+
+	var retryKeys <-chan hotkey.Event
+	retryHk := hotkey.New([]hotkey.Modifier{hotkey.ModCtrl, hotkey.ModOption, hotkey.ModCmd}, hotkey.KeyR)
+	err = retryHk.Register()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to register retry hotkey, use ojut ctl retry instead: %s\n", err)
+	} else {
+		retryKeys = retryHk.Keydown()
+		defer retryHk.Unregister()
+	}
+
 	kb, err := keybd_event.NewKeyBonding()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to register keyboard input: %s\n", err)
@@ -261,136 +632,176 @@ func fn() {
 	}
 
 	defer hk.Unregister()
-	fmt.Println("[Ojut is Ready]")
-	fmt.Println("Model:", strings.TrimSuffix(filepath.Base(modelFile), ".bin"))
+	fmt.Fprintln(statusOutput(active.config), "[Ojut is Ready]")
+	active.print()
+
+	history := &dictationContext{}
+	last := &utterance{}
+	out := newOutput(kb)
+	updates := make(chan *settings)
+	go watchConfig(configFilePath, cliConfig, active, updates)
+
+	requests := make(chan controlRequest)
+	listener, err := listenControl(requests)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to listen for ojut ctl commands: %s\n", err)
+	} else {
+		defer listener.Close()
+	}
 
 	for {
-		if err := runLoop(config, hk, kb, modelFile); err != nil {
-			log.Fatal(err)
+		select {
+		case s := <-updates:
+			fmt.Fprintln(statusOutput(s.config), "[Config reloaded]")
+			if s.modelFile != active.modelFile || s.escalationModelFile != active.escalationModelFile ||
+				s.retryModelFile != active.retryModelFile ||
+				s.config.Profile != active.config.Profile {
+				s.print()
+			}
+			active = s
+		case <-undoKeys:
+			if err := undoLast(out); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to undo: %s\n", err)
+			}
+		case <-retryKeys:
+			if err := retryLast(active, last, out); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to retry: %s\n", err)
+			}
+		case req := <-requests:
+			switch req.command {
+			case "undo":
+				req.reply <- undoLast(out)
+			case "retry":
+				req.reply <- retryLast(active, last, out)
+			}
+		case <-hk.Keydown():
+			if err := runLoop(active, history, last, hk, out); err != nil {
+				log.Fatal(err)
+			}
 		}
 	}
 }
 
-func runLoop(config *Config, hk *hotkey.Hotkey, kb keybd_event.KeyBonding, modelFile string) error {
-	<-hk.Keydown()
-	go playAudio()
-
-	fmt.Fprintf(os.Stderr, "Recording...\r")
-	audioBuffer := recordAudioWithDynamicNoiseFloor(hk.Keyup(), false)
+// isBlank reports if whisper did not hear anything. [BLANK_AUDIO] is
+// how whisper represents blank audio.
+func isBlank(text string) bool {
+	return text == "[BLANK_AUDIO]" || len(text) == 0
+}
 
+func runLoop(s *settings, history *dictationContext, last *utterance, hk *hotkey.Hotkey, out *output) error {
+	config := s.config
+	modelFile, escalationModelFile := s.modelFile, s.escalationModelFile
+	out.begin(config)
+	defer func() {
+		if err := out.end(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send text: %s\n", err)
+		}
+	}()
 	go playAudio()
-	// Clear needed here as we print out noise floor data
-	fmt.Fprintf(os.Stderr, "\x1b[2K\r"+"Processing...\r")
 
-	// Read dictionary from file if it exists
-	dictPath := filepath.Join(os.Getenv("HOME"), ".config", "ojut", "dictionary")
-	dictionary, err := readDictionaryFile(dictPath)
-	if err != nil && !os.IsNotExist(err) {
+	// Read dictionary from files if they exist
+	dictionary, err := loadDictionary(config)
+	if err != nil {
 		return fmt.Errorf("error reading dictionary file: %w", err)
 	}
-	initialPrompt := strings.Join(dictionary, ", ")
+	initialPrompt, dropped := buildPromptWithContext(dictionary, history.text(config), config.PromptTokenBudget)
+	warnDroppedEntries(dropped)
+	pipe := newPipeline(config, dictionaryTerms(dictionary))
+	out.setDictionary(dictionaryTerms(dictionary))
 
-	var combinedBuffer bytes.Buffer
-	header := createWAVHeader(uint32(audioBuffer.Len()))
+	// Every stage below gets its own deadline derived from this so
+	// that a hung stage does not block the next hotkey press.
+	ctx := context.Background()
 
-	err = binary.Write(&combinedBuffer, binary.LittleEndian, header)
-	if err != nil {
-		return err
+	fmt.Fprintf(os.Stderr, "Recording...\r")
+	if config.Streaming {
+		rec := &recording{}
+		stopped := make(chan struct{})
+		go func() {
+			recordAudio(hk.Keyup(), false, rec)
+			close(stopped)
+			go playAudio()
+		}()
+
+		text := streamDictation(ctx, config, pipe, rec, stopped, modelFile, initialPrompt, out)
+		*last = utterance{pcm: rec.Bytes(), prompt: initialPrompt, pipe: pipe, dictation: out.dictation}
+		printTranscript(config, text)
+		history.add(config, text, bytesToDuration(len(rec.Bytes())))
+		return nil
 	}
 
-	_, err = combinedBuffer.ReadFrom(audioBuffer)
-	if err != nil {
-		return err
-	}
+	audioBuffer := recordAudioWithDynamicNoiseFloor(hk.Keyup(), false)
+	*last = utterance{pcm: audioBuffer.Bytes(), prompt: initialPrompt, pipe: pipe, dictation: out.dictation}
 
-	cmd := exec.Command(
-		whisperBinary,
-		"-m",
-		modelFile,
-		"-f",
-		"-",
-		"-otxt",
-		"-np",
-		"-nt",
-		"--prompt",
-		initialPrompt)
-	cmd.Stdin = &combinedBuffer
-
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	err = cmd.Start()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to start audio processing: %s\n", err)
-	}
+	go playAudio()
+	// Clear needed here as we print out noise floor data
+	fmt.Fprintf(os.Stderr, "\x1b[2K\r"+"Processing...\r")
 
-	err = cmd.Wait()
+	speech := speechRatio(audioBuffer.Bytes())
+	wav := wavData(audioBuffer.Bytes())
+	result, err := transcribe(ctx, modelFile, wav, initialPrompt, config.Language, config.WhisperTimeout)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to process audio: %s\n", err)
-		fmt.Println(stderr.String())
+		fmt.Fprintf(os.Stderr, "\x1b[2K\rFailed to process audio: %s\n", err)
+		return nil
 	}
 
-	text := strings.TrimSpace(out.String())
+	// Re-run the same audio with the bigger model if the primary one
+	// was not sure about what it heard.
+	usedModel := modelFile
+	if escalationModelFile != "" && escalationModelFile != modelFile &&
+		!isBlank(result.Text) && result.Confidence < config.EscalationThreshold {
+		fmt.Fprintf(os.Stderr, "\x1b[2K\r"+"Low confidence (%.2f), retrying with %s...\r",
+			result.Confidence, modelName(escalationModelFile))
+
+		escalated, err := transcribe(ctx, escalationModelFile, wav, initialPrompt, config.Language, config.WhisperTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\x1b[2K\rFailed to process audio with escalation model: %s\n", err)
+		} else {
+			result = escalated
+			usedModel = escalationModelFile
+		}
+	}
 
 	// Clear line before printing
 	fmt.Fprintf(os.Stderr, "\x1b[2K\r")
-	fmt.Println(text)
-	if cmd.Err != nil {
-		fmt.Fprintf(os.Stderr, "Failed processing audio: %s\n", stderr.String())
-	}
+	fmt.Fprintf(os.Stderr, "[%s, confidence %.2f]\n", modelName(usedModel), result.Confidence)
+	printTranscript(config, result.Text)
+
+	text := pipe.process(result.Text, speech)
 
-	// This is how whisper represents blank audio. Skip it, it
-	// there is nothing.
-	if text == "[BLANK_AUDIO]" || len(text) == 0 {
+	if isBlank(text) {
 		return nil
 	}
+	history.add(config, text, bytesToDuration(audioBuffer.Len()))
+
+	emitText(ctx, config, out, text)
+	return nil
+}
 
+// emitText sends out the transcript, running any spoken commands in it
+// and post-processing the rest if enabled
+func emitText(ctx context.Context, config *Config, out *output, text string) {
+	segments := parseCommands(config, text)
 	if config.PostProcess {
-		// Use default system prompt if none provided
-		systemPrompt := config.LLMSystemPrompt
-		if len(systemPrompt) == 0 {
-			systemPrompt = "Cleanup the following transcript and add punctuation. Do not change anything else."
-		}
+		segments = joinSegments(segments)
+	}
 
-		// Create LLM config
-		apiKey := os.Getenv("OJUT_LLM_API_KEY")
-		if len(apiKey) == 0 {
-			apiKey = os.Getenv("OPENAI_API_KEY")
-			if len(apiKey) == 0 {
-				return fmt.Errorf("neither OJUT_LLM_API_KEY nor OPENAI_API_KEY environment variables are set")
+	for _, seg := range segments {
+		if seg.action != "" {
+			err := out.perform(seg.action)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to run command '%s': %s\n", seg.action, err)
 			}
+			continue
 		}
 
-		llmConfig := openai.DefaultConfig(apiKey)
-
-		// Use configured base URL if available, otherwise check env var
-		if config.LLMBaseURL != "" {
-			llmConfig.BaseURL = config.LLMBaseURL
-		} else if apiURL := os.Getenv("OJUT_LLM_ENDPOINT"); len(apiURL) > 0 {
-			llmConfig.BaseURL = apiURL
-		}
-
-		// Get LLM model name
-		model := config.LLMModel
-		if len(model) == 0 {
-			model = os.Getenv("OJUT_LLM_MODEL")
-			if len(model) == 0 {
-				model = "gpt-4o-mini"
+		if config.PostProcess {
+			postProcess(ctx, config, seg.text, out)
+		} else {
+			err := out.insert(seg.text)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to paste text: %s\n", err)
 			}
 		}
-
-		err = streamFromLLM(text, systemPrompt, kb, llmConfig, model)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to stream from LLM: %s\n", err)
-		}
-	} else {
-		err = pasteString(text, kb)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to paste text: %s\n", err)
-		}
 	}
-
-	return nil
 }
@@ -0,0 +1,51 @@
+package main
+
+/*
+#cgo LDFLAGS: -framework ApplicationServices
+#include <ApplicationServices/ApplicationServices.h>
+
+static int modifiersHeld() {
+	CGEventFlags flags = CGEventSourceFlagsState(kCGEventSourceStateHIDSystemState);
+	return (flags & (kCGEventFlagMaskShift | kCGEventFlagMaskControl |
+		kCGEventFlagMaskAlternate | kCGEventFlagMaskCommand)) != 0;
+}
+
+static int releaseKey(CGKeyCode key) {
+	CGEventRef event = CGEventCreateKeyboardEvent(NULL, key, false);
+	if (event == NULL) {
+		return 0;
+	}
+	CGEventSetFlags(event, 0);
+	CGEventPost(kCGHIDEventTap, event);
+	CFRelease(event);
+	return 1;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+
+	"github.com/micmonay/keybd_event"
+)
+
+// Key codes of the left and right command, shift, option and control
+// keys
+var darwinModifierKeys = []C.CGKeyCode{0x37, 0x36, 0x38, 0x3C, 0x3A, 0x3D, 0x3B, 0x3E}
+
+// heldModifiers reports if any of the modifier keys are held down
+func heldModifiers() (bool, error) {
+	return C.modifiersHeld() != 0, nil
+}
+
+// releaseModifiers sends key up events for the modifier keys. keybd_event
+// only sends them for the keys it was asked to press on macOS, so we post
+// the events ourselves.
+func releaseModifiers(kb keybd_event.KeyBonding) error {
+	for _, key := range darwinModifierKeys {
+		if C.releaseKey(key) == 0 {
+			return fmt.Errorf("unable to create key up event")
+		}
+	}
+	return nil
+}
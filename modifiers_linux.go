@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/micmonay/keybd_event"
+)
+
+// X11 key codes of the left and right ctrl, shift, alt and super keys
+var x11ModifierKeys = []string{"37", "105", "50", "62", "64", "108", "133", "134"}
+
+// heldModifiers reports if any of the modifier keys are held down. X11
+// only knows about the keyboard on Wayland when one of its windows is
+// focused, so we cannot tell there.
+func heldModifiers() (bool, error) {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		return false, fmt.Errorf("held keys cannot be checked on Wayland")
+	}
+
+	out, err := exec.Command("xinput", "query-state", "Virtual core keyboard").Output()
+	if err != nil {
+		return false, fmt.Errorf("xinput failed: %w", err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		for _, code := range x11ModifierKeys {
+			if strings.TrimSpace(line) == "key["+code+"]=down" {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// releaseModifiers sends key up events for the modifier keys
+func releaseModifiers(kb keybd_event.KeyBonding) error {
+	kb.Clear()
+	kb.HasCTRL(true)
+	kb.HasCTRLR(true)
+	kb.HasSHIFT(true)
+	kb.HasSHIFTR(true)
+	kb.HasALT(true)
+	kb.HasALTGR(true)
+	kb.HasSuper(true)
+	return kb.Release()
+}
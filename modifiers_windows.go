@@ -0,0 +1,32 @@
+package main
+
+import "github.com/micmonay/keybd_event"
+
+var getAsyncKeyState = user32.NewProc("GetAsyncKeyState")
+
+// Virtual key codes of shift, ctrl, alt and the windows keys
+var windowsModifierKeys = []uintptr{0x10, 0x11, 0x12, 0x5B, 0x5C}
+
+// heldModifiers reports if any of the modifier keys are held down
+func heldModifiers() (bool, error) {
+	for _, key := range windowsModifierKeys {
+		state, _, _ := getAsyncKeyState.Call(key)
+		if state&0x8000 != 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// releaseModifiers sends key up events for the modifier keys
+func releaseModifiers(kb keybd_event.KeyBonding) error {
+	kb.Clear()
+	kb.HasCTRL(true)
+	kb.HasCTRLR(true)
+	kb.HasSHIFT(true)
+	kb.HasSHIFTR(true)
+	kb.HasALT(true)
+	kb.HasALTGR(true)
+	kb.HasSuper(true)
+	return kb.Release()
+}
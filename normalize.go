@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// normalizeRule rewrites the spoken form at the start of the words
+// into its written form (twenty three percent => 23%). Words are
+// lowercase and without punctuation at the edges. It returns the
+// written form and the number of words it took up, which is zero if
+// the rule does not apply. Without a written form, the words are kept
+// as they are.
+type normalizeRule func(words []string) (string, int)
+
+// Rule sets per language, tried in order at every word. Languages
+// without a rule set are left alone.
+var normalizeRules = map[string][]normalizeRule{
+	"en": {
+		englishTime,
+		englishDate,
+		englishCurrency,
+		englishPercent,
+		englishUnit,
+		englishOrdinal,
+		englishCardinal,
+	},
+}
+
+// normalizeWord prepares a word from whisper for matching
+func normalizeWord(word string) string {
+	return strings.ToLower(strings.Trim(word, `.,;:!?"()`))
+}
+
+type normalizeToken struct {
+	raw string
+
+	// Part of a hyphenated word (forty-two) that was split up
+	hyphenated bool
+}
+
+// splitHyphenated splits hyphenated number words (forty-two,
+// twenty-first) so that the rules can see the individual words
+func splitHyphenated(text string) []normalizeToken {
+	var tokens []normalizeToken
+	for _, word := range strings.Fields(text) {
+		parts := strings.Split(word, "-")
+		split := len(parts) > 1
+		for _, part := range parts {
+			w := normalizeWord(part)
+			if _, ok := unitWords[w]; !ok && tensWords[w] == 0 && englishOrdinals[w] == 0 {
+				split = false
+			}
+		}
+
+		if !split {
+			tokens = append(tokens, normalizeToken{raw: word})
+			continue
+		}
+		for i, part := range parts {
+			tokens = append(tokens, normalizeToken{raw: part, hyphenated: i > 0})
+		}
+	}
+	return tokens
+}
+
+// normalizeText converts spoken numbers, ordinals, percentages,
+// currency, times, dates and units into their written form using the
+// rules for the language. Punctuation around the converted words is
+// kept.
+func normalizeText(language, text string) string {
+	rules, found := normalizeRules[language]
+	if !found {
+		return text
+	}
+
+	tokens := splitHyphenated(text)
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = normalizeWord(t.raw)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(tokens); {
+		written, n := "", 0
+		for _, rule := range rules {
+			if written, n = rule(words[i:]); n > 0 {
+				break
+			}
+		}
+
+		if written == "" {
+			for _, t := range tokens[i : i+max(n, 1)] {
+				if t.hyphenated {
+					sb.WriteByte('-')
+				} else if sb.Len() > 0 {
+					sb.WriteByte(' ')
+				}
+				sb.WriteString(t.raw)
+			}
+			i += max(n, 1)
+			continue
+		}
+
+		leading, _ := punctuation(tokens[i].raw, tokens[i].raw)
+		_, trailing := punctuation(tokens[i+n-1].raw, tokens[i+n-1].raw)
+		if _, ok := isMeridiem(words[i+n-1]); ok {
+			// The period of p.m. is part of the word
+			trailing = strings.TrimPrefix(trailing, ".")
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(leading + written + trailing)
+		i += n
+	}
+
+	return sb.String()
+}
+
+var englishOrdinals = map[string]int{
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5,
+	"sixth": 6, "seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+	"eleventh": 11, "twelfth": 12, "thirteenth": 13, "fourteenth": 14,
+	"fifteenth": 15, "sixteenth": 16, "seventeenth": 17,
+	"eighteenth": 18, "nineteenth": 19, "twentieth": 20,
+	"thirtieth": 30, "fortieth": 40, "fiftieth": 50, "sixtieth": 60,
+	"seventieth": 70, "eightieth": 80, "ninetieth": 90,
+	"hundredth": 100, "thousandth": 1000, "millionth": 1000000,
+}
+
+// Months that are also common words (we march on, it may rain). They
+// only start a date along with an ordinal day, like march third.
+var englishWordMonths = map[string]bool{"march": true, "may": true}
+
+var englishMonths = []string{
+	"january", "february", "march", "april", "may", "june", "july",
+	"august", "september", "october", "november", "december",
+}
+
+// English units, longest first so that "degrees celsius" is matched
+// before "degrees"
+var englishUnits = []struct {
+	words  string
+	symbol string
+}{
+	{"kilometers per hour", "km/h"},
+	{"kilometres per hour", "km/h"},
+	{"miles per hour", "mph"},
+	{"megabits per second", "Mbps"},
+	{"gigabits per second", "Gbps"},
+	{"degrees celsius", "°C"},
+	{"degrees fahrenheit", "°F"},
+	{"degree celsius", "°C"},
+	{"degree fahrenheit", "°F"},
+	{"kilometers", "km"}, {"kilometres", "km"}, {"kilometer", "km"}, {"kilometre", "km"},
+	{"centimeters", "cm"}, {"centimetres", "cm"}, {"centimeter", "cm"}, {"centimetre", "cm"},
+	{"millimeters", "mm"}, {"millimetres", "mm"}, {"millimeter", "mm"}, {"millimetre", "mm"},
+	{"meters", "m"}, {"metres", "m"}, {"meter", "m"}, {"metre", "m"},
+	{"kilograms", "kg"}, {"kilogram", "kg"},
+	{"milligrams", "mg"}, {"milligram", "mg"},
+	{"grams", "g"}, {"gram", "g"},
+	{"milliliters", "mL"}, {"millilitres", "mL"}, {"milliliter", "mL"}, {"millilitre", "mL"},
+	{"liters", "L"}, {"litres", "L"}, {"liter", "L"}, {"litre", "L"},
+	{"kilobytes", "KB"}, {"kilobyte", "KB"},
+	{"megabytes", "MB"}, {"megabyte", "MB"},
+	{"gigabytes", "GB"}, {"gigabyte", "GB"},
+	{"terabytes", "TB"}, {"terabyte", "TB"},
+	{"milliseconds", "ms"}, {"millisecond", "ms"},
+	{"kilohertz", "kHz"}, {"megahertz", "MHz"}, {"gigahertz", "GHz"}, {"hertz", "Hz"},
+	{"degrees", "°"}, {"degree", "°"},
+}
+
+var englishCurrencies = map[string]string{
+	"dollar": "$", "dollars": "$",
+	"euro": "€", "euros": "€",
+	"yen":   "¥",
+	"rupee": "₹", "rupees": "₹",
+}
+
+// englishNumber parses a cardinal number, either spoken or in digits
+func englishNumber(words []string) (string, int) {
+	if len(words) > 0 && isNumber(words[0]) {
+		return words[0], 1
+	}
+	return parseNumberWords(words)
+}
+
+// englishSmallNumber parses a spoken or written number that fits the
+// range, like an hour or a day of the month
+func englishSmallNumber(words []string, low, high int) (int, int) {
+	number, n := englishNumber(words)
+	if n == 0 {
+		return 0, 0
+	}
+
+	value, err := strconv.Atoi(number)
+	if err != nil || value < low || value > high {
+		return 0, 0
+	}
+	return value, n
+}
+
+// englishCardinal converts spoken numbers. Single numbers below ten
+// are left as words (one of them), which is how they are usually
+// written, along with any numbers right after them (five fifteen,
+// seven eleven) as we cannot tell what those are. Recent years read out
+// in pairs (nineteen ninety nine) are converted as years.
+func englishCardinal(words []string) (string, int) {
+	if len(words) == 0 || isNumber(words[0]) {
+		return "", 0
+	}
+
+	number, n := parseNumberWords(words)
+	if n == 0 {
+		return "", 0
+	}
+
+	if year, m := englishYear(words); m > n && year >= 1800 && year < 2100 {
+		return strconv.Itoa(year), m
+	}
+
+	if value, err := strconv.Atoi(number); n == 1 && err == nil && value < 10 {
+		for {
+			_, m := parseNumberWords(words[n:])
+			if m == 0 {
+				break
+			}
+			n += m
+		}
+		if n == 1 {
+			return "", 0
+		}
+		return "", n
+	}
+	return number, n
+}
+
+func ordinalSuffix(value int) string {
+	switch {
+	case value%100 >= 11 && value%100 <= 13:
+		return "th"
+	case value%10 == 1:
+		return "st"
+	case value%10 == 2:
+		return "nd"
+	case value%10 == 3:
+		return "rd"
+	}
+	return "th"
+}
+
+// parseEnglishOrdinal parses spoken (twenty third) or written (23rd)
+// ordinals
+func parseEnglishOrdinal(words []string) (int, int) {
+	if len(words) == 0 {
+		return 0, 0
+	}
+
+	// 23rd
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		if digits, found := strings.CutSuffix(words[0], suffix); found && isDigits(digits) {
+			value, _ := strconv.Atoi(digits)
+			return value, 1
+		}
+	}
+
+	for k := 0; k < len(words) && k < 8; k++ {
+		ordinal, found := englishOrdinals[words[k]]
+		if !found {
+			continue
+		}
+
+		if k == 0 {
+			return ordinal, 1
+		}
+
+		// one hundred and first
+		prefix := words[:k]
+		if prefix[len(prefix)-1] == "and" {
+			prefix = prefix[:len(prefix)-1]
+		}
+		number, used := parseNumberWords(prefix)
+		if used == 0 || used != len(prefix) || strings.Contains(number, ".") || strings.HasPrefix(number, "-") {
+			return 0, 0
+		}
+		value, _ := strconv.Atoi(number)
+
+		switch {
+		case ordinal >= 100:
+			return value * ordinal, k + 1
+		case ordinal < 10 && value%10 == 0:
+			return value + ordinal, k + 1
+		case ordinal < 100 && value%100 == 0:
+			return value + ordinal, k + 1
+		}
+		return 0, 0
+	}
+
+	return 0, 0
+}
+
+// englishOrdinal converts spoken ordinals of ten and above (twenty
+// third => 23rd). Smaller ones are left as words.
+func englishOrdinal(words []string) (string, int) {
+	// Leave ordinals that are already written out (23rd) alone
+	if len(words) == 0 || len(words[0]) == 0 || isDigits(words[0][:1]) {
+		return "", 0
+	}
+
+	value, n := parseEnglishOrdinal(words)
+	if n == 0 || value < 10 {
+		return "", 0
+	}
+	return strconv.Itoa(value) + ordinalSuffix(value), n
+}
+
+func englishPercent(words []string) (string, int) {
+	number, n := englishNumber(words)
+	if n == 0 || n >= len(words) {
+		return "", 0
+	}
+
+	switch {
+	case words[n] == "percent":
+		return number + "%", n + 1
+	case words[n] == "per" && n+1 < len(words) && words[n+1] == "cent":
+		return number + "%", n + 2
+	}
+	return "", 0
+}
+
+// englishCurrency converts amounts like five dollars and fifty cents
+// into $5.50
+func englishCurrency(words []string) (string, int) {
+	number, n := englishNumber(words)
+	if n == 0 || n >= len(words) {
+		return "", 0
+	}
+
+	symbol, found := englishCurrencies[words[n]]
+	if !found {
+		return "", 0
+	}
+	used := n + 1
+
+	// and fifty cents
+	if used+2 < len(words) && words[used] == "and" && !strings.Contains(number, ".") {
+		cents, m := englishSmallNumber(words[used+1:], 0, 99)
+		if m > 0 && used+1+m < len(words) && (words[used+1+m] == "cents" || words[used+1+m] == "cent") {
+			number = fmt.Sprintf("%s.%02d", number, cents)
+			used += m + 2
+		}
+	}
+
+	return symbol + number, used
+}
+
+// englishUnit converts measurements like five kilometers into 5 km
+func englishUnit(words []string) (string, int) {
+	number, n := englishNumber(words)
+	if n == 0 || n >= len(words) {
+		return "", 0
+	}
+
+	for _, unit := range englishUnits {
+		unitWords := strings.Fields(unit.words)
+		if n+len(unitWords) > len(words) || strings.Join(words[n:n+len(unitWords)], " ") != unit.words {
+			continue
+		}
+
+		if strings.HasPrefix(unit.symbol, "°") {
+			return number + unit.symbol, n + len(unitWords)
+		}
+		return number + " " + unit.symbol, n + len(unitWords)
+	}
+	return "", 0
+}
+
+func isMeridiem(word string) (string, bool) {
+	switch strings.ReplaceAll(word, ".", "") {
+	case "am":
+		return "AM", true
+	case "pm":
+		return "PM", true
+	}
+	return "", false
+}
+
+// englishTime converts times like three thirty pm or ten o'clock. Times
+// without am/pm or o'clock are too ambiguous to convert.
+func englishTime(words []string) (string, int) {
+	hour, n := englishSmallNumber(words, 1, 12)
+	if n == 0 || n >= len(words) {
+		return "", 0
+	}
+
+	if words[n] == "o'clock" || words[n] == "oclock" {
+		return fmt.Sprintf("%d:00", hour), n + 1
+	}
+
+	if meridiem, ok := isMeridiem(words[n]); ok {
+		return fmt.Sprintf("%d %s", hour, meridiem), n + 1
+	}
+
+	// three oh five pm
+	minutes, m := 0, 0
+	if words[n] == "oh" && n+1 < len(words) {
+		if value, found := unitWords[words[n+1]]; found && value > 0 && value < 10 {
+			minutes, m = value, 2
+		}
+	} else {
+		minutes, m = englishSmallNumber(words[n:], 10, 59)
+	}
+	if m == 0 || n+m >= len(words) {
+		return "", 0
+	}
+
+	meridiem, ok := isMeridiem(words[n+m])
+	if !ok {
+		return "", 0
+	}
+	return fmt.Sprintf("%d:%02d %s", hour, minutes, meridiem), n + m + 1
+}
+
+// englishYear parses years read out in pairs (nineteen ninety nine,
+// twenty oh five, twenty twenty four) or as a number
+func englishYear(words []string) (int, int) {
+	if value, n := englishSmallNumber(words, 1000, 2999); n > 0 {
+		return value, n
+	}
+
+	century, n := englishSmallNumber(words, 10, 99)
+	if n == 0 || n >= len(words) {
+		return 0, 0
+	}
+
+	switch {
+	case words[n] == "hundred":
+		return century * 100, n + 1
+	case words[n] == "oh" && n+1 < len(words):
+		if value, found := unitWords[words[n+1]]; found && value > 0 && value < 10 {
+			return century*100 + value, n + 2
+		}
+	default:
+		if value, m := englishSmallNumber(words[n:], 10, 99); m > 0 {
+			return century*100 + value, n + m
+		}
+	}
+	return 0, 0
+}
+
+// englishDate converts dates like march third twenty twenty four into
+// March 3, 2024
+func englishDate(words []string) (string, int) {
+	if len(words) < 2 {
+		return "", 0
+	}
+
+	month := ""
+	for _, name := range englishMonths {
+		if words[0] == name {
+			month = capitalize(name)
+		}
+	}
+	if month == "" {
+		return "", 0
+	}
+
+	day, n := parseEnglishOrdinal(words[1:])
+	if n == 0 && !englishWordMonths[words[0]] {
+		day, n = englishSmallNumber(words[1:], 1, 31)
+	}
+	if n > 0 && (day < 1 || day > 31) {
+		n = 0
+	}
+
+	used := 1 + n
+	year, m := englishYear(words[used:])
+	switch {
+	case n > 0 && m > 0:
+		return fmt.Sprintf("%s %d, %d", month, day, year), used + m
+	case n > 0:
+		return fmt.Sprintf("%s %d", month, day), used
+	case m > 0 && !englishWordMonths[words[0]]:
+		return fmt.Sprintf("%s %d", month, year), 1 + m
+	}
+	return "", 0
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"cardinal", "I have twenty three apples", "I have 23 apples"},
+		{"hyphenated cardinal", "forty-two is the answer", "42 is the answer"},
+		{"decimal", "three point one four is pi", "3.14 is pi"},
+		{"small numbers stay words", "one of the two", "one of the two"},
+		{"small number before a number", "meet at five fifteen", "meet at five fifteen"},
+		{"small number before a compound number", "call me at nine forty five", "call me at nine forty five"},
+		{"small number before tens", "chapter one twenty", "chapter one twenty"},
+		{"small number before a teen", "seven eleven", "seven eleven"},
+		{"small number before a hyphenated number", "Nine forty-five, then", "Nine forty-five, then"},
+		{"ordinal", "the twenty first century", "the 21st century"},
+		{"hyphenated ordinal", "the forty-second street", "the 42nd street"},
+		{"ordinal with and", "one hundred and first", "101st"},
+		{"small ordinals stay words", "I came first and second", "I came first and second"},
+		{"ordinal after and", "the nineteenth and twentieth centuries", "the 19th and 20th centuries"},
+		{"percent", "fifty percent", "50%"},
+		{"currency", "twenty one dollars", "$21"},
+		{"currency with cents", "five dollars and fifty cents", "$5.50"},
+		{"time", "meet me at three thirty p.m.", "meet me at 3:30 PM"},
+		{"date", "born on june third, nineteen ninety nine", "born on June 3, 1999"},
+		{"march with ordinal", "march third twenty twenty four", "March 3, 2024"},
+		{"may with ordinal", "may fifth", "May 5"},
+		{"march as a verb", "we march three miles", "we march three miles"},
+		{"march as a verb before a year", "they march twenty twenty four", "they march 2024"},
+		{"may as a verb", "it may rain", "it may rain"},
+		{"unit", "run five kilometers", "run 5 km"},
+		{"punctuation is kept", "That is five percent.", "That is 5%."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizeText("en", tt.in)
+			if got != tt.want {
+				t.Errorf("normalizeText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
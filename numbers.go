@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+var unitWords = map[string]int{
+	"zero": 0, "oh": 0, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11,
+	"twelve": 12, "thirteen": 13, "fourteen": 14, "fifteen": 15,
+	"sixteen": 16, "seventeen": 17, "eighteen": 18, "nineteen": 19,
+}
+
+var tensWords = map[string]int{
+	"twenty": 20, "thirty": 30, "forty": 40, "fifty": 50,
+	"sixty": 60, "seventy": 70, "eighty": 80, "ninety": 90,
+}
+
+var scaleWords = map[string]int{
+	"thousand": 1000, "million": 1000000, "billion": 1000000000,
+}
+
+func isDigits(word string) bool {
+	if len(word) == 0 {
+		return false
+	}
+	for _, r := range word {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNumberWords parses a spoken English number (forty two, three
+// hundred and five, minus one point five) from the start of the
+// words. Words are expected to be lowercase and without punctuation.
+// It returns the number as digits along with the number of words it
+// took up, which is zero if the words do not start with a number.
+func parseNumberWords(words []string) (string, int) {
+	i := 0
+	sign := ""
+	if len(words) > 1 && (words[0] == "minus" || words[0] == "negative") {
+		sign = "-"
+		i++
+	}
+
+	// Whisper often gives us digits already
+	if i < len(words) && isDigits(words[i]) {
+		return sign + words[i], i + 1
+	}
+
+	// Kind of the last word so that "two three" is not read as five
+	const (
+		none = iota
+		unit
+		tens
+		hundred
+		scale
+	)
+
+	total, current := 0, 0
+	last, used := none, i
+	for ; i < len(words); i++ {
+		word := words[i]
+		if value, ok := unitWords[word]; ok && word != "oh" {
+			if last == unit || (last == tens && value >= 10) {
+				break
+			}
+			current += value
+			last = unit
+		} else if value, ok := tensWords[word]; ok {
+			if last == unit || last == tens {
+				break
+			}
+			current += value
+			last = tens
+		} else if word == "hundred" && (last == unit) {
+			current *= 100
+			last = hundred
+		} else if value, ok := scaleWords[word]; ok && last != none && last != scale {
+			total += current * value
+			current = 0
+			last = scale
+		} else if word == "and" && (last == hundred || last == scale) && i+1 < len(words) {
+			// one hundred and five
+			continue
+		} else {
+			break
+		}
+		used = i + 1
+	}
+
+	if last == none {
+		return "", 0
+	}
+	number := sign + strconv.Itoa(total+current)
+
+	// Decimals are read out digit by digit
+	if used+1 < len(words) && words[used] == "point" {
+		var decimals strings.Builder
+		j := used + 1
+		for ; j < len(words); j++ {
+			value, ok := unitWords[words[j]]
+			if !ok || value > 9 {
+				break
+			}
+			decimals.WriteString(strconv.Itoa(value))
+		}
+		if decimals.Len() > 0 {
+			number += "." + decimals.String()
+			used = j
+		}
+	}
+
+	return number, used
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/micmonay/keybd_event"
+)
+
+// insertion is a piece of text we sent out, along with the dictation
+// it was a part of
+type insertion struct {
+	text      string
+	dictation int
+}
+
+// output sends text to the configured sinks and key presses to the
+// focused application. It keeps track of what it inserted so that
+// spoken commands like "scratch that" and undo can take it back.
+type output struct {
+	kb         keybd_event.KeyBonding
+	keys       *keyboardOutput
+	config     *Config
+	sinks      []sink
+	insertions []insertion
+
+	// Number of the current dictation
+	dictation int
+
+	// Words of the dictionary terms, which keep their case
+	terms map[string]bool
+
+	// When we last sent something out
+	last time.Time
+
+	// Whether keys are held back while modifier keys are held down,
+	// along with the ones waiting to be sent
+	deferKeys bool
+	pending   []func() error
+}
+
+func newOutput(kb keybd_event.KeyBonding) *output {
+	return &output{kb: kb}
+}
+
+// begin starts a new dictation. Only the last few dictations are kept
+// around for undo.
+func (o *output) begin(config *Config) {
+	if config != o.config {
+		keys, err := newKeyboardOutput(config, o.kb)
+		var sinks []sink
+		if err == nil {
+			sinks, err = newSinks(config, keys)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to set up outputs, keeping the previous ones: %s\n", err)
+		} else {
+			o.keys, o.sinks = keys, sinks
+		}
+	}
+
+	o.config = config
+	o.dictation++
+
+	i := 0
+	for i < len(o.insertions) && o.insertions[i].dictation <= o.dictation-config.UndoLevels {
+		i++
+	}
+	o.insertions = o.insertions[i:]
+}
+
+// setDictionary sets the dictionary terms, which are names and the like
+// that keep their case when continuing a sentence
+func (o *output) setDictionary(terms []string) {
+	o.terms = map[string]bool{}
+	for _, term := range terms {
+		for _, word := range strings.Fields(term) {
+			o.terms[word] = true
+		}
+	}
+}
+
+// keepsCase reports if the word keeps its capital in the middle of a
+// sentence. Words that are all capitals (JSON) are left alone by
+// uncapitalize already.
+func (o *output) keepsCase(word string) bool {
+	word = trimPunctuation(word)
+	return word == "I" || strings.HasPrefix(word, "I'") || o.terms[word]
+}
+
+func (o *output) record(text string) {
+	o.insertions = append(o.insertions, insertion{text: text, dictation: o.dictation})
+	o.last = time.Now()
+}
+
+// hasKeyboard reports if any of the sinks type into the focused
+// application. Key presses are only sent if so.
+func (o *output) hasKeyboard() bool {
+	for _, s := range o.sinks {
+		if s.keyboard() {
+			return true
+		}
+	}
+	return false
+}
+
+// modifiersHeld reports if we would have to wait for modifier keys to
+// be let go before sending keys
+func (o *output) modifiersHeld() bool {
+	if !o.hasKeyboard() || o.config.HeldModifiers != modifiersWait {
+		return false
+	}
+
+	held, err := heldModifiers()
+	return err == nil && held
+}
+
+// dictationText returns everything sent out as part of the current
+// dictation
+func (o *output) dictationText() string {
+	var sb strings.Builder
+	for _, ins := range o.insertions {
+		if ins.dictation == o.dictation {
+			sb.WriteString(ins.text)
+		}
+	}
+	return sb.String()
+}
+
+// write sends the text to the sinks. If keys is set, keyboard sinks
+// are skipped as the caller sends them key presses instead.
+func (o *output) write(text string, keys bool) error {
+	dictation := o.dictationText() + text
+
+	var errs []error
+	for _, s := range o.sinks {
+		var err error
+		switch {
+		case keys && s.keyboard():
+			continue
+		case s.keyboard():
+			err = o.sendKeys(func() error { return s.write(text, dictation) })
+		default:
+			err = s.write(text, dictation)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// end lets the sinks know that the current dictation is done
+func (o *output) end() error {
+	dictation := o.dictationText()
+
+	var errs []error
+	for _, s := range o.sinks {
+		if err := s.end(dictation); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendKeys runs op, which sends keys to the focused application. If
+// keys are deferred and modifier keys are held down, it is queued up
+// until they are let go instead.
+func (o *output) sendKeys(op func() error) error {
+	o.pending = append(o.pending, op)
+	if o.deferKeys && o.modifiersHeld() {
+		return nil
+	}
+	return o.flushKeys()
+}
+
+// flushKeys sends the keys that were held back
+func (o *output) flushKeys() error {
+	pending := o.pending
+	o.pending = nil
+
+	var errs []error
+	for _, op := range pending {
+		if err := op(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// press sends the key presses to the keyboard sinks and the text they
+// stand for to the others
+func (o *output) press(text string, key string, times int) error {
+	err := o.write(text, true)
+	if o.hasKeyboard() {
+		keys := o.keys
+		err = errors.Join(err, o.sendKeys(func() error { return keys.tap(key, times) }))
+	}
+
+	o.record(text)
+	return err
+}
+
+// erase sends a backspace for every character of the text. Text that
+// went to the other sinks cannot be taken back.
+func (o *output) erase(text string) error {
+	if !o.hasKeyboard() {
+		return nil
+	}
+	keys := o.keys
+	return o.sendKeys(func() error { return keys.tap("backspace", graphemeCount(text)) })
+}
+
+// lastDictation returns the dictation that the last insertion was a
+// part of, zero if there is none
+func (o *output) lastDictation() int {
+	if len(o.insertions) == 0 {
+		return 0
+	}
+	return o.insertions[len(o.insertions)-1].dictation
+}
+
+// undo takes back everything inserted by the last dictation
+func (o *output) undo() (string, error) {
+	if len(o.insertions) == 0 {
+		return "", fmt.Errorf("nothing to undo")
+	}
+
+	dictation := o.insertions[len(o.insertions)-1].dictation
+	i := len(o.insertions)
+	for i > 0 && o.insertions[i-1].dictation == dictation {
+		i--
+	}
+
+	var sb strings.Builder
+	for _, ins := range o.insertions[i:] {
+		sb.WriteString(ins.text)
+	}
+	o.insertions = o.insertions[:i]
+
+	return sb.String(), o.erase(sb.String())
+}
+
+// insert sends out the text as a new insertion
+func (o *output) insert(text string) error {
+	if len(text) == 0 {
+		return nil
+	}
+
+	text = o.continuation(text)
+	err := o.write(text, false)
+	if err != nil {
+		return err
+	}
+
+	o.record(text)
+	return nil
+}
+
+// endsSentence reports if text that follows this should start a new
+// sentence
+func endsSentence(text string) bool {
+	if strings.HasSuffix(strings.TrimRight(text, " \t"), "\n") {
+		return true
+	}
+
+	trimmed := strings.TrimRightFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`"')]`, r)
+	})
+	return len(trimmed) == 0 || strings.ContainsAny(trimmed[len(trimmed)-1:], ".!?")
+}
+
+// continuation adapts the text to what we inserted right before it,
+// if that was within the continuity window. A space is added in
+// between and the case of the first letter is adjusted to whether the
+// previous text ended a sentence.
+func (o *output) continuation(text string) string {
+	if o.config == nil || o.config.ContinuityWindow < 0 || len(o.insertions) == 0 ||
+		time.Since(o.last) > o.config.ContinuityWindow {
+		return text
+	}
+	previous := o.insertions[len(o.insertions)-1].text
+
+	// Text that brings its own spacing is already continuing
+	// something, like the words we commit while streaming
+	first, _ := utf8.DecodeRuneInString(text)
+	if unicode.IsSpace(first) {
+		return text
+	}
+
+	if !o.config.CodeMode {
+		word, rest, found := strings.Cut(text, " ")
+		if endsSentence(previous) {
+			word = capitalize(word)
+		} else if !o.keepsCase(word) {
+			word = uncapitalize(word)
+		}
+
+		text = word
+		if found {
+			text += " " + rest
+		}
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(previous)
+	if !unicode.IsSpace(last) && !strings.ContainsRune(".,;:!?)]}", first) {
+		text = " " + text
+	}
+	return text
+}
+
+// extend sends out the text as a continuation of the last insertion. This
+// is for text that comes in pieces, like the response from the LLM, so
+// that it can be taken back as a whole.
+func (o *output) extend(text string) error {
+	if len(o.insertions) == 0 {
+		return o.insert(text)
+	}
+
+	err := o.write(text, false)
+	if err != nil {
+		return err
+	}
+
+	o.insertions[len(o.insertions)-1].text += text
+	o.last = time.Now()
+	return nil
+}
+
+// perform runs the action of a spoken command
+func (o *output) perform(action string) error {
+	o.last = time.Now()
+
+	switch action {
+	case actionEnter:
+		return o.press("\n", "enter", 1)
+	case actionParagraph:
+		return o.press("\n\n", "enter", 2)
+	case actionTab:
+		return o.press("\t", "tab", 1)
+	case actionScratch:
+		if len(o.insertions) == 0 {
+			return fmt.Errorf("nothing to scratch")
+		}
+
+		last := o.insertions[len(o.insertions)-1]
+		o.insertions = o.insertions[:len(o.insertions)-1]
+		return o.erase(last.text)
+	case actionSelectAll:
+		// Whatever we inserted is about to be replaced or moved
+		// around, so we can no longer take it back
+		o.insertions = nil
+		if !o.hasKeyboard() {
+			return nil
+		}
+		keys := o.keys
+		return o.sendKeys(func() error { return keys.tap(shortcutModifier+"+a", 1) })
+	}
+
+	return fmt.Errorf("unknown action '%s'", action)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// AppPasteChord overrides the paste chord for the applications whose
+// focused window matches. Class and Title are regular expressions,
+// matched case-insensitively, and both have to match if both are set.
+type AppPasteChord struct {
+	// Window class (the application name on macOS)
+	Class string `yaml:"class" json:"class"`
+
+	// Title of the focused window
+	Title string `yaml:"title" json:"title"`
+
+	// Chord to paste with, like ctrl+shift+v
+	Chord string `yaml:"chord" json:"chord"`
+}
+
+// chord is a key pressed along with modifiers, like ctrl+shift+v. AltGr
+// is only used for typing characters from the keyboard layout.
+type chord struct {
+	key   int
+	name  string
+	ctrl  bool
+	shift bool
+	alt   bool
+	altgr bool
+	super bool
+}
+
+// parseChord parses chords like cmd+v or ctrl+shift+v. The key is
+// looked up in the keyboard layout so that it is the key labelled with
+// it, falling back to the key names used in layout files.
+func parseChord(text string, layout keyboardLayout) (chord, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(text)), "+")
+
+	var c chord
+	for _, modifier := range parts[:len(parts)-1] {
+		switch strings.TrimSpace(modifier) {
+		case "ctrl", "control":
+			c.ctrl = true
+		case "shift":
+			c.shift = true
+		case "alt", "option", "opt":
+			c.alt = true
+		case "cmd", "command", "super", "win", "meta":
+			c.super = true
+		default:
+			return chord{}, fmt.Errorf("unknown modifier '%s' in chord '%s'", modifier, text)
+		}
+	}
+
+	key := strings.TrimSpace(parts[len(parts)-1])
+	if char, size := utf8.DecodeRuneInString(key); size == len(key) {
+		if stroke, found := layout[char]; found && !stroke.shift && !stroke.altgr {
+			c.key, c.name = stroke.key, key
+			return c, nil
+		}
+	}
+
+	code, found := keyCode(key)
+	if !found {
+		return chord{}, fmt.Errorf("unknown key '%s' in chord '%s'", key, text)
+	}
+	c.key, c.name = code, key
+	return c, nil
+}
+
+type appChord struct {
+	class *regexp.Regexp
+	title *regexp.Regexp
+	chord chord
+}
+
+// pasteChords picks the chord to paste with for the focused window
+type pasteChords struct {
+	chord chord
+	apps  []appChord
+
+	// We only complain once about not finding the focused window
+	warned bool
+}
+
+func newPasteChords(config *Config, layout keyboardLayout) (*pasteChords, error) {
+	c, err := parseChord(config.PasteChord, layout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid paste_chord: %w", err)
+	}
+
+	// The built-in chords paste the clipboard, while shift+insert
+	// pastes the primary selection in terminals as well
+	apps := config.AppPasteChords
+	if config.ClipboardSelection != selectionPrimary {
+		apps = append(apps, defaultAppPasteChords...)
+	}
+
+	p := &pasteChords{chord: c}
+	for _, app := range apps {
+		a := appChord{}
+		if app.Class == "" && app.Title == "" {
+			return nil, fmt.Errorf("app_paste_chords need a class or a title to match")
+		}
+		if app.Class != "" {
+			a.class, err = regexp.Compile("(?i)" + app.Class)
+			if err != nil {
+				return nil, fmt.Errorf("invalid class in app_paste_chords: %w", err)
+			}
+		}
+		if app.Title != "" {
+			a.title, err = regexp.Compile("(?i)" + app.Title)
+			if err != nil {
+				return nil, fmt.Errorf("invalid title in app_paste_chords: %w", err)
+			}
+		}
+
+		a.chord, err = parseChord(app.Chord, layout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chord in app_paste_chords: %w", err)
+		}
+		p.apps = append(p.apps, a)
+	}
+
+	return p, nil
+}
+
+// focused returns the chord for the focused window. The user's
+// overrides come first, followed by the built-in ones unless pasting
+// through the primary selection.
+func (p *pasteChords) focused() chord {
+	if len(p.apps) == 0 {
+		return p.chord
+	}
+
+	class, title, err := focusedWindow()
+	if err != nil {
+		if !p.warned {
+			fmt.Fprintf(os.Stderr, "Unable to find the focused window, using the default paste chord: %s\n", err)
+			p.warned = true
+		}
+		return p.chord
+	}
+
+	for _, app := range p.apps {
+		if app.class != nil && !app.class.MatchString(class) {
+			continue
+		}
+		if app.title != nil && !app.title.MatchString(title) {
+			continue
+		}
+		return app.chord
+	}
+	return p.chord
+}
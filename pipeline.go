@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// pipeline cleans up the text that we get from whisper before it is
+// post-processed or typed out. It is created for every dictation so
+// that changes to the files it reads from take effect right away.
+type pipeline struct {
+	config       *Config
+	replacements []replacement
+	fuzzy        *fuzzyMatcher
+	symbols      []symbol
+}
+
+func newPipeline(config *Config, dictionary []string) *pipeline {
+	p := &pipeline{config: config}
+
+	var err error
+	p.replacements, err = readReplacementsFile(configPath("replacements"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading replacements file, skipping replacements: %s\n", err)
+	}
+
+	p.symbols, err = readSymbolTable(configPath("symbols"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading symbols file, using built-in symbols: %s\n", err)
+		p.symbols, _ = readSymbolTable("")
+	}
+
+	if config.FuzzyCorrection {
+		p.fuzzy = newFuzzyMatcher(dictionary, config.FuzzyAllow, config.FuzzyDeny, config.FuzzyThreshold)
+	}
+
+	return p
+}
+
+// process runs the text through all the stages. speech is the
+// fraction of the audio that was speech.
+func (p *pipeline) process(text string, speech float64) string {
+	text = filterTranscript(p.config, text, speech)
+	text = applyReplacements(text, p.replacements, func(rule replacement, count int) {
+		debugf(p.config, "Replaced %s => %s [%dx]", rule.from, rule.to, count)
+	})
+
+	if p.fuzzy != nil {
+		var corrections []fuzzyCorrection
+		text, corrections = p.fuzzy.correct(text)
+		for _, c := range corrections {
+			debugf(p.config, "Corrected '%s' => '%s' (score %.2f)", c.from, c.to, c.score)
+		}
+	}
+
+	if p.config.NormalizeText {
+		text = normalizeText(p.config.Language, text)
+	}
+
+	// Symbol mode is either always on or turned on for a single
+	// dictation by starting it with the prefix. Code mode includes it.
+	text, prefixed := stripSymbolPrefix(text, p.config.SymbolPrefix)
+	if p.config.CodeMode {
+		text = convertCode(text, p.symbols)
+	} else if prefixed || p.config.SymbolMode {
+		text = convertSymbols(text, p.symbols)
+	}
+
+	return text
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// How often we check the config file for changes
+const configPollInterval = 2 * time.Second
+
+// settings is the active config along with the model files it
+// resolves to
+type settings struct {
+	config              *Config
+	modelFile           string
+	escalationModelFile string
+	retryModelFile      string
+}
+
+// loadConfig reads the config file and applies the CLI args on top
+// of it. CLI args always take precedence, even across reloads.
+func loadConfig(filePath string, cliConfig *Config) (*Config, error) {
+	config, err := readConfigFromFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		config = &Config{}
+	}
+
+	// The profile has to be applied before the rest of the CLI args
+	// so that they can override the values from the profile
+	if cliConfig.Profile != "" {
+		config.Profile = cliConfig.Profile
+	}
+	config, err = config.withProfile(config.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	config = overrideConfigWithCLIArgs(config, cliConfig)
+	config.applyDefaults()
+
+	err = config.validate()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// resolveSettings picks the model files for the config, downloading
+// them if necessary. If no model is configured, we keep using
+// currentModelFile. The picker is only shown on startup.
+func resolveSettings(config *Config, currentModelFile string) (*settings, error) {
+	s := &settings{config: config, modelFile: currentModelFile}
+
+	var err error
+	if config.Model != "" || currentModelFile == "" {
+		s.modelFile, err = selectModel(config.Model)
+		if err != nil {
+			return nil, fmt.Errorf("unable to pick model: %w", err)
+		}
+	}
+
+	if config.EscalationModel != "" {
+		s.escalationModelFile, err = selectModel(config.EscalationModel)
+		if err != nil {
+			return nil, fmt.Errorf("unable to pick escalation model: %w", err)
+		}
+	}
+
+	s.retryModelFile = s.escalationModelFile
+	if config.RetryModel != "" {
+		s.retryModelFile, err = selectModel(config.RetryModel)
+		if err != nil {
+			return nil, fmt.Errorf("unable to pick retry model: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *settings) print() {
+	w := statusOutput(s.config)
+	if s.config.Profile != "" {
+		fmt.Fprintln(w, "Profile:", s.config.Profile)
+	}
+	fmt.Fprintln(w, "Model:", modelName(s.modelFile))
+	if s.escalationModelFile != "" {
+		fmt.Fprintln(w, "Escalation model:", modelName(s.escalationModelFile))
+	}
+	if s.retryModelFile != "" && s.retryModelFile != s.escalationModelFile {
+		fmt.Fprintln(w, "Retry model:", modelName(s.retryModelFile))
+	}
+	if s.config.Streaming && (s.config.PostProcess || s.escalationModelFile != "") {
+		fmt.Fprintln(w, "Streaming is enabled, skipping escalation and post-processing")
+	}
+}
+
+func modTime(filePath string) time.Time {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+// watchConfig polls the config file and sends over new settings
+// whenever it changes. The main loop picks them up in between
+// utterances. Configs that fail to load or validate are rejected and
+// we keep using the last good one.
+func watchConfig(filePath string, cliConfig *Config, current *settings, updates chan<- *settings) {
+	lastModified := modTime(filePath)
+	for range time.Tick(configPollInterval) {
+		modified := modTime(filePath)
+		if modified.Equal(lastModified) {
+			continue
+		}
+		lastModified = modified
+
+		config, err := loadConfig(filePath, cliConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\x1b[2K\rRejected config change: %s\n", err)
+			continue
+		}
+
+		s, err := resolveSettings(config, current.modelFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\x1b[2K\rRejected config change: %s\n", err)
+			continue
+		}
+
+		current = s
+		updates <- s
+	}
+}
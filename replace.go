@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// replacement is a single rule from the replacements file. Rules are
+// either literal (case insensitive, whole words only, preserving the
+// case of what was matched) or regular expressions written as
+// /pattern/ or /pattern/i.
+type replacement struct {
+	line    int
+	from    string
+	to      string
+	literal bool
+	pattern *regexp.Regexp
+}
+
+// readReplacementsFile parses the replacements file. Each line is of
+// the form `from => to`. Empty lines and lines starting with # are
+// ignored.
+func readReplacementsFile(filePath string) ([]replacement, error) {
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return []replacement{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var rules []replacement
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		from, to, found := strings.Cut(trimmed, "=>")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected 'from => to'", i+1)
+		}
+
+		rule, err := newReplacement(strings.TrimSpace(from), strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rule.line = i + 1
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func newReplacement(from, to string) (replacement, error) {
+	if len(from) == 0 {
+		return replacement{}, fmt.Errorf("empty pattern")
+	}
+
+	rule := replacement{from: from, to: to}
+	if len(from) > 2 && strings.HasPrefix(from, "/") &&
+		(strings.HasSuffix(from, "/") || strings.HasSuffix(from, "/i")) {
+		expr := strings.TrimPrefix(from, "/")
+		if strings.HasSuffix(expr, "/i") {
+			expr = "(?i)" + strings.TrimSuffix(expr, "/i")
+		} else {
+			expr = strings.TrimSuffix(expr, "/")
+		}
+
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return replacement{}, err
+		}
+		rule.pattern = pattern
+		return rule, nil
+	}
+
+	rule.literal = true
+	rule.pattern = regexp.MustCompile("(?i)" + regexp.QuoteMeta(from))
+	return rule, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// atWordBoundary checks that text[start:end] is not part of a bigger
+// word. Sides of the match that are not word characters themselves
+// (eg: the + in c++) match anywhere.
+func atWordBoundary(text string, start, end int) bool {
+	first, _ := utf8.DecodeRuneInString(text[start:end])
+	if before, size := utf8.DecodeLastRuneInString(text[:start]); size > 0 && isWordRune(first) && isWordRune(before) {
+		return false
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(text[start:end])
+	if after, size := utf8.DecodeRuneInString(text[end:]); size > 0 && isWordRune(last) && isWordRune(after) {
+		return false
+	}
+
+	return true
+}
+
+func isAllUpper(text string) bool {
+	letters := 0
+	for _, r := range text {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	return letters > 1
+}
+
+func capitalize(text string) string {
+	r, size := utf8.DecodeRuneInString(text)
+	return string(unicode.ToUpper(r)) + text[size:]
+}
+
+// matchCase adapts the case of the replacement to the text it is
+// replacing. Replacements that have uppercase letters in them are
+// considered to have an explicit case and are only changed if the
+// match was shouting.
+func matchCase(matched, replacement string) string {
+	if isAllUpper(matched) {
+		return strings.ToUpper(replacement)
+	}
+
+	if replacement != strings.ToLower(replacement) {
+		return replacement
+	}
+
+	if first, _ := utf8.DecodeRuneInString(matched); unicode.IsUpper(first) {
+		return capitalize(replacement)
+	}
+	return replacement
+}
+
+// apply returns the text with the rule applied and the number of
+// replacements made
+func (r replacement) apply(text string) (string, int) {
+	matches := r.pattern.FindAllStringIndex(text, -1)
+	if !r.literal {
+		return r.pattern.ReplaceAllString(text, r.to), len(matches)
+	}
+
+	var sb strings.Builder
+	last, count := 0, 0
+	for _, loc := range matches {
+		if !atWordBoundary(text, loc[0], loc[1]) {
+			continue
+		}
+
+		sb.WriteString(text[last:loc[0]])
+		sb.WriteString(matchCase(text[loc[0]:loc[1]], r.to))
+		last = loc[1]
+		count++
+	}
+	sb.WriteString(text[last:])
+
+	return sb.String(), count
+}
+
+// applyReplacements runs the text through all the rules in order. The
+// callback, if any, is called for every rule that matched.
+func applyReplacements(text string, rules []replacement, matched func(replacement, int)) string {
+	for _, rule := range rules {
+		var count int
+		text, count = rule.apply(text)
+		if count > 0 && matched != nil {
+			matched(rule, count)
+		}
+	}
+	return text
+}
+
+// replaceCommand implements `ojut replace test "<text>"` which shows
+// what the replacement rules do to the given text.
+func replaceCommand(args []string) int {
+	if len(args) != 2 || args[0] != "test" {
+		fmt.Fprintf(os.Stderr, "Usage: ojut replace test \"<text>\"\n")
+		return 2
+	}
+
+	rules, err := readReplacementsFile(configPath("replacements"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading replacements file: %s\n", err)
+		return 1
+	}
+
+	result := applyReplacements(args[1], rules, func(rule replacement, count int) {
+		fmt.Printf("line %d: %s => %s [%dx]\n", rule.line, rule.from, rule.to, count)
+	})
+	fmt.Println(result)
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// utterance is the audio of the last dictation, kept around so that it
+// can be re-transcribed with a better model
+type utterance struct {
+	pcm       []byte
+	prompt    string
+	pipe      *pipeline
+	dictation int
+}
+
+// retryLast re-transcribes the last dictation with the retry model and
+// replaces the text it inserted with the new result. This only works
+// if nothing was dictated since.
+func retryLast(s *settings, last *utterance, out *output) error {
+	config := s.config
+	if len(last.pcm) == 0 {
+		return fmt.Errorf("nothing to retry")
+	}
+	if last.dictation != out.dictation {
+		return fmt.Errorf("something else was dictated since")
+	}
+	if s.retryModelFile == "" {
+		return fmt.Errorf("no retry_model configured")
+	}
+
+	fmt.Fprintf(os.Stderr, "Retrying with %s...\r", modelName(s.retryModelFile))
+	ctx := context.Background()
+	result, err := transcribe(ctx, s.retryModelFile, wavData(last.pcm), last.prompt, config.Language, config.WhisperTimeout)
+	fmt.Fprintf(os.Stderr, "\x1b[2K\r")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "[%s, confidence %.2f]\n", modelName(s.retryModelFile), result.Confidence)
+	printTranscript(config, result.Text)
+
+	text := last.pipe.process(result.Text, speechRatio(last.pcm))
+	if isBlank(text) {
+		return fmt.Errorf("retry did not hear anything, keeping the original")
+	}
+
+	// The new text takes the place of the old one, as its own
+	// dictation so that it can be undone
+	if out.lastDictation() == last.dictation {
+		_, err = out.undo()
+		if err != nil {
+			return err
+		}
+	}
+	out.begin(config)
+	last.dictation = out.dictation
+
+	emitText(ctx, config, out, text)
+	return out.end()
+}
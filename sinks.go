@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/atotto/clipboard"
+)
+
+// Kinds of output sinks
+const (
+	sinkPaste     = "paste"
+	sinkType      = "type"
+	sinkClipboard = "clipboard"
+	sinkStdout    = "stdout"
+	sinkFile      = "file"
+	sinkFIFO      = "fifo"
+	sinkCommand   = "command"
+)
+
+// Maximum time a command sink is allowed to take
+const sinkCommandTimeout = 10 * time.Second
+
+// OutputConfig configures one of the places dictated text is sent to
+type OutputConfig struct {
+	// Kind of output (paste, type, clipboard, stdout, file, fifo or
+	// command)
+	Type string `yaml:"type" json:"type"`
+
+	// File or FIFO to write to, relative to the config directory
+	Path string `yaml:"path" json:"path"`
+
+	// Shell command to pipe the text to
+	Command string `yaml:"command" json:"command"`
+}
+
+// sink is somewhere the dictated text goes. Text comes in pieces, text
+// is the new piece and dictation is all of the current dictation so
+// far, including the piece.
+type sink interface {
+	write(text, dictation string) error
+
+	// end is called once the dictation is done, with all of its text
+	end(dictation string) error
+
+	// Keyboard sinks insert text into the focused application. They
+	// are the ones that spoken commands and undo send keys to.
+	keyboard() bool
+}
+
+type pasteSink struct{ keys *keyboardOutput }
+
+func (s *pasteSink) write(text, _ string) error { return pasteString(text, s.keys) }
+func (s *pasteSink) end(string) error           { return nil }
+func (s *pasteSink) keyboard() bool             { return true }
+
+type typeSink struct{ keys *keyboardOutput }
+
+func (s *typeSink) write(text, _ string) error { return typeString(text, s.keys) }
+func (s *typeSink) end(string) error           { return nil }
+func (s *typeSink) keyboard() bool             { return true }
+
+// clipboardSink leaves the whole dictation on the clipboard
+type clipboardSink struct{}
+
+func (clipboardSink) write(_, dictation string) error { return clipboard.WriteAll(dictation) }
+func (clipboardSink) end(string) error                { return nil }
+func (clipboardSink) keyboard() bool                  { return false }
+
+type stdoutSink struct{}
+
+func (stdoutSink) write(text, _ string) error {
+	_, err := fmt.Print(text)
+	return err
+}
+func (stdoutSink) end(string) error { return nil }
+func (stdoutSink) keyboard() bool   { return false }
+
+// fileSink appends to a file, with every dictation on its own line
+type fileSink struct {
+	path string
+
+	// Whether anything was written for the current dictation
+	written bool
+}
+
+func (s *fileSink) write(text, _ string) error {
+	s.written = true
+	return s.append(text)
+}
+
+func (s *fileSink) end(string) error {
+	if !s.written {
+		return nil
+	}
+	s.written = false
+	return s.append("\n")
+}
+
+func (s *fileSink) append(text string) error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(text)
+	return err
+}
+func (s *fileSink) keyboard() bool { return false }
+
+// fifoSink writes to a named pipe. We do not wait around for a reader,
+// the text is dropped if nobody is listening.
+type fifoSink struct{ path string }
+
+func (s *fifoSink) write(text, _ string) error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s does not exist, create it with mkfifo", s.path)
+	} else if err != nil {
+		return fmt.Errorf("unable to open %s, is anything reading from it? %w", s.path, err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(text)
+	return err
+}
+func (s *fifoSink) end(string) error { return nil }
+func (s *fifoSink) keyboard() bool   { return false }
+
+// commandSink runs a shell command once the dictation is done, passing
+// all of its text in over stdin
+type commandSink struct{ command string }
+
+func (s *commandSink) write(string, string) error { return nil }
+
+func (s *commandSink) end(dictation string) error {
+	if len(dictation) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sinkCommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.command)
+	cmd.Stdin = strings.NewReader(dictation)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+func (s *commandSink) keyboard() bool { return false }
+
+// sinkPath resolves paths in the config, which can either be absolute,
+// start with ~ or be relative to the config directory
+func sinkPath(path string) string {
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		return filepath.Join(os.Getenv("HOME"), rest)
+	}
+	if !filepath.IsAbs(path) {
+		return configPath(path)
+	}
+	return path
+}
+
+func newSink(c OutputConfig, keys *keyboardOutput) (sink, error) {
+	switch c.Type {
+	case sinkPaste:
+		return &pasteSink{keys: keys}, nil
+	case sinkType:
+		return &typeSink{keys: keys}, nil
+	case sinkClipboard:
+		return clipboardSink{}, nil
+	case sinkStdout:
+		return stdoutSink{}, nil
+	case sinkFile, sinkFIFO:
+		if c.Path == "" {
+			return nil, fmt.Errorf("output '%s' needs a path", c.Type)
+		}
+		if c.Type == sinkFile {
+			return &fileSink{path: sinkPath(c.Path)}, nil
+		}
+		return &fifoSink{path: sinkPath(c.Path)}, nil
+	case sinkCommand:
+		if c.Command == "" {
+			return nil, fmt.Errorf("output 'command' needs a command")
+		}
+		return &commandSink{command: c.Command}, nil
+	}
+
+	return nil, fmt.Errorf("unknown output '%s'", c.Type)
+}
+
+func newSinks(config *Config, keys *keyboardOutput) ([]sink, error) {
+	var sinks []sink
+	for _, c := range config.Outputs {
+		s, err := newSink(c, keys)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+func hasOutput(config *Config, kind string) bool {
+	for _, c := range config.Outputs {
+		if c.Type == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// statusOutput returns where to print messages for the user to see. If
+// the text is going to stdout, they go to stderr instead so that stdout
+// only has the text.
+func statusOutput(config *Config) io.Writer {
+	if hasOutput(config, sinkStdout) {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printTranscript prints the transcript for the user to see
+func printTranscript(config *Config, text string) {
+	fmt.Fprintln(statusOutput(config), text)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Whisper works on 30 second windows. Once the audio we have not
+// finalized gets longer than this, we split it at a quiet point and
+// start over with a fresh window.
+const maxStreamWindow = 25 * time.Second
+
+// Number of committed words passed on to whisper as context when
+// starting a new window
+const streamContextWords = 30
+
+// streamer transcribes overlapping windows of the audio while it is
+// still being recorded. Words that two consecutive transcriptions of
+// the same window agree on are considered stable and are committed to
+// the output right away. Committed text is never changed afterwards.
+type streamer struct {
+	config    *Config
+	pipe      *pipeline
+	modelFile string
+	prompt    string
+	out       *output
+
+	// Byte offset into the recording where the current window starts
+	windowStart int
+
+	// Words of the current window that we have committed and the
+	// latest transcription of the window
+	committed []string
+	previous  []string
+
+	// Everything committed so far, across windows
+	text []string
+
+	// Whether the next text needs a space in front of it. Not the
+	// case at the start or after a command like "new line".
+	separate bool
+}
+
+func bytesToDuration(n int) time.Duration {
+	return time.Duration(n/2) * time.Second / sampleRate
+}
+
+// streamDictation runs until recording is stopped and all of the audio
+// has been transcribed. It returns all the text that was committed.
+func streamDictation(
+	ctx context.Context,
+	config *Config,
+	pipe *pipeline,
+	rec *recording,
+	stopped <-chan struct{},
+	modelFile, prompt string,
+	out *output,
+) string {
+	s := &streamer{config: config, pipe: pipe, modelFile: modelFile, prompt: prompt, out: out}
+
+	// The hotkey is usually still held down while we commit, so keys
+	// are held back until it is let go
+	out.deferKeys = true
+	defer func() { out.deferKeys = false }()
+
+	ticker := time.NewTicker(config.StreamInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			s.finish(ctx, rec.Bytes())
+			return strings.Join(s.text, " ")
+		case <-ticker.C:
+			s.update(ctx, rec.Bytes())
+		}
+	}
+}
+
+func (s *streamer) transcribe(ctx context.Context, pcm []byte) ([]string, error) {
+	// Whatever we already committed is the best context we can give
+	// whisper for the new window.
+	prompt := s.prompt
+	if len(s.text) > 0 {
+		recent := s.text[max(0, len(s.text)-streamContextWords):]
+		prompt = strings.TrimPrefix(prompt+" "+strings.Join(recent, " "), " ")
+	}
+
+	result, err := transcribe(ctx, s.modelFile, wavData(pcm), prompt, s.config.Language, s.config.WhisperTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(s.pipe.process(result.Text, speechRatio(pcm))), nil
+}
+
+// update transcribes the current window and commits the words that are
+// now stable.
+func (s *streamer) update(ctx context.Context, pcm []byte) {
+	window := pcm[s.windowStart:]
+	if bytesToDuration(len(window)) < time.Second {
+		return
+	}
+
+	if bytesToDuration(len(window)) > maxStreamWindow {
+		cut := s.windowStart + quietestPoint(window, 3*time.Second)
+		s.finalize(ctx, pcm[s.windowStart:cut])
+		s.windowStart = cut
+		return
+	}
+
+	words, err := s.transcribe(ctx, window)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\x1b[2K\rFailed to process audio: %s\n", err)
+		return
+	}
+
+	stable := 0
+	for stable < len(words) && stable < len(s.previous) && words[stable] == s.previous[stable] {
+		stable++
+	}
+	s.previous = words
+
+	if stable > len(s.committed) {
+		s.commit(words[len(s.committed):stable])
+	}
+
+	s.showPartial(words)
+}
+
+// finalize transcribes the window one last time and commits
+// everything that was not already committed.
+func (s *streamer) finalize(ctx context.Context, window []byte) {
+	words, err := s.transcribe(ctx, window)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\x1b[2K\rFailed to process audio: %s\n", err)
+		words = s.previous
+	}
+
+	// The final transcription might not agree with what we already
+	// committed. We cannot take that back, so we only add the words
+	// past what has been committed.
+	if len(words) > len(s.committed) {
+		s.commit(words[len(s.committed):])
+	}
+
+	s.committed = nil
+	s.previous = nil
+}
+
+func (s *streamer) finish(ctx context.Context, pcm []byte) {
+	window := pcm[s.windowStart:]
+	if len(window) > 0 {
+		s.finalize(ctx, window)
+	}
+
+	// Clear the partial transcript
+	fmt.Fprintf(os.Stderr, "\x1b[2K\r")
+
+	s.out.deferKeys = false
+	err := s.out.flushKeys()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to paste text: %s\n", err)
+	}
+}
+
+// commit sends out the words, running any spoken commands in them.
+// Commands are only recognized if all of their words are committed
+// together.
+func (s *streamer) commit(words []string) {
+	for _, seg := range parseCommands(s.config, strings.Join(words, " ")) {
+		if seg.action != "" {
+			err := s.out.perform(seg.action)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\x1b[2K\rFailed to run command '%s': %s\n", seg.action, err)
+			}
+			s.separate = false
+			continue
+		}
+
+		text := seg.text
+		if s.separate {
+			text = " " + text
+		}
+
+		err := s.out.insert(text)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\x1b[2K\rFailed to paste text: %s\n", err)
+			return
+		}
+		s.separate = true
+	}
+
+	s.committed = append(s.committed, words...)
+	s.text = append(s.text, words...)
+}
+
+// showPartial shows the tail of the current transcription with the
+// part that is not yet committed dimmed.
+func (s *streamer) showPartial(words []string) {
+	const width = 80
+
+	committed := []rune(strings.Join(s.committed, " "))
+	var pending []rune
+	if len(words) > len(s.committed) {
+		pending = []rune(" " + strings.Join(words[len(s.committed):], " "))
+	}
+
+	if len(pending) >= width {
+		committed, pending = nil, append([]rune("…"), pending[len(pending)-width:]...)
+	} else if len(committed)+len(pending) > width {
+		committed = append([]rune("…"), committed[len(committed)-(width-len(pending)):]...)
+	}
+
+	fmt.Fprintf(os.Stderr, "\x1b[2K\r%s\x1b[2m%s\x1b[0m", string(committed), string(pending))
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// How a symbol attaches to the words around it
+const (
+	glueNone  = "none"  // spaces on both sides, eg: a + b
+	glueLeft  = "left"  // attaches to the previous word, eg: a, b
+	glueRight = "right" // attaches to the next word, eg: (a
+	glueBoth  = "both"  // attaches to both, eg: a_b
+)
+
+// Default phrase to say at the start of a dictation to turn on symbol
+// mode just for that dictation
+const defaultSymbolPrefix = "symbol mode"
+
+// Built-in symbol table, in the same format as the symbols file
+const defaultSymbolTable = `
+period => . left
+full stop => . left
+comma => , left
+colon => : left
+semicolon => ; left
+question mark => ? left
+exclamation mark => ! left
+exclamation point => ! left
+open paren => ( right
+close paren => ) left
+open parenthesis => ( right
+close parenthesis => ) left
+open bracket => [ right
+close bracket => ] left
+open brace => { right
+close brace => } left
+less than => <
+greater than => >
+double quote => "
+single quote => '
+backtick => ` + "`" + `
+at sign => @ both
+underscore => _ both
+hyphen => - both
+dash => -
+dot => . both
+slash => / both
+backslash => \ both
+hash => # right
+dollar sign => $ right
+percent => % left
+ampersand => &
+asterisk => *
+plus => +
+equals => =
+pipe => |
+tilde => ~ right
+caret => ^
+arrow => ->
+`
+
+// symbol is a single entry of the symbol table
+type symbol struct {
+	words []string
+	text  string
+	glue  string
+}
+
+// defaultGlue guesses how a symbol attaches to the words around it
+// when the table does not say
+func defaultGlue(text string) string {
+	switch {
+	case strings.ContainsAny(text, "([{") && len(text) == 1:
+		return glueRight
+	case strings.ContainsAny(text, ".,;:!?)]}%") && len(text) == 1:
+		return glueLeft
+	}
+	return glueNone
+}
+
+// parseSymbolTable parses lines of the form `phrase => symbol [glue]`
+// where glue is one of none, left, right or both. Empty lines and
+// lines starting with # are ignored.
+func parseSymbolTable(data string) ([]symbol, error) {
+	var symbols []symbol
+	for i, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		phrase, rest, found := strings.Cut(trimmed, "=>")
+		fields := strings.Fields(rest)
+		if !found || len(normalizePhrase(phrase)) == 0 || len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected 'phrase => symbol [glue]'", i+1)
+		}
+
+		s := symbol{words: strings.Fields(normalizePhrase(phrase)), text: fields[0], glue: defaultGlue(fields[0])}
+		if len(fields) == 2 {
+			switch fields[1] {
+			case glueNone, glueLeft, glueRight, glueBoth:
+				s.glue = fields[1]
+			default:
+				return nil, fmt.Errorf("line %d: unknown glue '%s'", i+1, fields[1])
+			}
+		}
+		symbols = append(symbols, s)
+	}
+
+	return symbols, nil
+}
+
+// readSymbolTable returns the built-in symbol table along with the
+// entries from the symbols file. Entries in the file override the
+// built-in ones for the same phrase.
+func readSymbolTable(filePath string) ([]symbol, error) {
+	symbols, err := parseSymbolTable(defaultSymbolTable)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	custom, err := parseSymbolTable(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	byPhrase := map[string]int{}
+	for i, s := range symbols {
+		byPhrase[strings.Join(s.words, " ")] = i
+	}
+	for _, s := range custom {
+		if i, found := byPhrase[strings.Join(s.words, " ")]; found {
+			symbols[i] = s
+			continue
+		}
+		symbols = append(symbols, s)
+	}
+
+	// Longest phrases first so that "question mark" wins over a
+	// shorter phrase it might start with
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return len(symbols[i].words) > len(symbols[j].words)
+	})
+	return symbols, nil
+}
+
+// stripSymbolPrefix removes the symbol mode prefix from the start of
+// the text, if it is there
+func stripSymbolPrefix(text, prefix string) (string, bool) {
+	prefixWords := strings.Fields(normalizePhrase(prefix))
+	words := strings.Fields(text)
+	if len(prefixWords) == 0 || len(words) < len(prefixWords) ||
+		normalizePhrase(strings.Join(words[:len(prefixWords)], " ")) != strings.Join(prefixWords, " ") {
+		return text, false
+	}
+	return strings.Join(words[len(prefixWords):], " "), true
+}
+
+// symbolToken is either a symbol or a word as it came from whisper
+type symbolToken struct {
+	text   string
+	glue   string
+	symbol bool
+}
+
+// tokenizeSymbols splits the text into words and symbols. Reserved
+// phrases are kept as words even if they start with a symbol name.
+func tokenizeSymbols(text string, symbols []symbol, reserved []string) []symbolToken {
+	var tokens []symbolToken
+	words := strings.Fields(text)
+	for i := 0; i < len(words); {
+		matched := false
+		for _, phrase := range reserved {
+			n := len(strings.Fields(phrase))
+			if n > len(words)-i || normalizePhrase(strings.Join(words[i:i+n], " ")) != phrase {
+				continue
+			}
+
+			for _, word := range words[i : i+n] {
+				tokens = append(tokens, symbolToken{text: word, glue: glueNone})
+			}
+			i += n
+			matched = true
+			break
+		}
+
+		for _, s := range symbols {
+			if matched {
+				break
+			}
+
+			n := len(s.words)
+			if n > len(words)-i || normalizePhrase(strings.Join(words[i:i+n], " ")) != strings.Join(s.words, " ") {
+				continue
+			}
+
+			tokens = append(tokens, symbolToken{text: s.text, glue: s.glue, symbol: true})
+			i += n
+			matched = true
+			break
+		}
+
+		if !matched {
+			tokens = append(tokens, symbolToken{text: words[i], glue: glueNone})
+			i++
+		}
+	}
+	return tokens
+}
+
+// trimPunctuation drops the punctuation whisper adds at the edges of
+// words
+func trimPunctuation(word string) string {
+	return strings.Trim(word, ".,;:!?")
+}
+
+// joinTokens joins the tokens with spaces, except where a symbol
+// attaches to its neighbour
+func joinTokens(tokens []symbolToken) string {
+	var sb strings.Builder
+	for i, t := range tokens {
+		if i > 0 {
+			prev := tokens[i-1].glue
+			if prev != glueRight && prev != glueBoth && t.glue != glueLeft && t.glue != glueBoth {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(t.text)
+	}
+	return sb.String()
+}
+
+// convertSymbols turns spoken symbol names into the symbols and fixes
+// up the spacing around them. As the punctuation is being dictated,
+// whatever punctuation whisper added at the edges of words is dropped.
+func convertSymbols(text string, symbols []symbol) string {
+	var tokens []symbolToken
+	for _, t := range tokenizeSymbols(text, symbols, nil) {
+		if !t.symbol {
+			t.text = trimPunctuation(t.text)
+		}
+		if len(t.text) > 0 {
+			tokens = append(tokens, t)
+		}
+	}
+	return joinTokens(tokens)
+}
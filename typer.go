@@ -1,154 +1,111 @@
 package main
 
-import (
-	"unicode"
+import "time"
 
-	"github.com/atotto/clipboard"
-	"github.com/micmonay/keybd_event"
-)
-
-// Explicit mapping for a-z characters
-var charToKeyCode = map[rune]int{
-	'a': keybd_event.VK_A, 'b': keybd_event.VK_B, 'c': keybd_event.VK_C, 'd': keybd_event.VK_D,
-	'e': keybd_event.VK_E, 'f': keybd_event.VK_F, 'g': keybd_event.VK_G, 'h': keybd_event.VK_H,
-	'i': keybd_event.VK_I, 'j': keybd_event.VK_J, 'k': keybd_event.VK_K, 'l': keybd_event.VK_L,
-	'm': keybd_event.VK_M, 'n': keybd_event.VK_N, 'o': keybd_event.VK_O, 'p': keybd_event.VK_P,
-	'q': keybd_event.VK_Q, 'r': keybd_event.VK_R, 's': keybd_event.VK_S, 't': keybd_event.VK_T,
-	'u': keybd_event.VK_U, 'v': keybd_event.VK_V, 'w': keybd_event.VK_W, 'x': keybd_event.VK_X,
-	'y': keybd_event.VK_Y, 'z': keybd_event.VK_Z,
-}
-
-// Mapping for numbers
-var numberToKeyCode = map[rune]int{
-	'1': keybd_event.VK_1, '2': keybd_event.VK_2, '3': keybd_event.VK_3, '4': keybd_event.VK_4,
-	'5': keybd_event.VK_5, '6': keybd_event.VK_6, '7': keybd_event.VK_7, '8': keybd_event.VK_8,
-	'9': keybd_event.VK_9, '0': keybd_event.VK_0,
-}
-
-// Mapping for special characters
-var specialKeys = map[rune]int{
-	' ':  keybd_event.VK_SPACE,
-	'.':  keybd_event.VK_Period,
-	',':  keybd_event.VK_COMMA,
-	'-':  keybd_event.VK_MINUS,
-	'=':  keybd_event.VK_EQUAL,
-	'[':  keybd_event.VK_LeftBracket,
-	']':  keybd_event.VK_RightBracket,
-	';':  keybd_event.VK_SEMICOLON,
-	'\'': keybd_event.VK_Quote,
-	'\\': keybd_event.VK_BACKSLASH,
-	'/':  keybd_event.VK_SLASH,
-	'`':  keybd_event.VK_GRAVE,
-}
+// typeString types out the string using key presses. Characters that
+// do not have a key (accented letters, em-dashes, curly quotes) are
+// collected into runs and pasted in between.
+func typeString(str string, keys *keyboardOutput) error {
+	err := keys.ready()
+	if err != nil {
+		return err
+	}
 
-var shiftedSpecialKeys = map[rune]int{
-	'~': keybd_event.VK_GRAVE,
-	'!': keybd_event.VK_1,
-	'@': keybd_event.VK_2,
-	'#': keybd_event.VK_3,
-	'$': keybd_event.VK_4,
-	'%': keybd_event.VK_5,
-	'^': keybd_event.VK_6,
-	'&': keybd_event.VK_7,
-	'*': keybd_event.VK_8,
-	'(': keybd_event.VK_9,
-	')': keybd_event.VK_0,
-	'_': keybd_event.VK_MINUS,
-	'+': keybd_event.VK_EQUAL,
-	'{': keybd_event.VK_LeftBracket,
-	'}': keybd_event.VK_RightBracket,
-	':': keybd_event.VK_SEMICOLON,
-	'"': keybd_event.VK_Quote,
-	'|': keybd_event.VK_BACKSLASH,
-	'>': keybd_event.VK_Period,
-	'<': keybd_event.VK_COMMA,
-	'?': keybd_event.VK_SLASH,
-}
+	// Keyboards that type text by themselves get the runs of text
+	// they can type in one go
+	text, isText := keys.keyboard.(textKeyboard)
+	var typed, unsupported []rune
+	flush := func() error {
+		var err error
+		if len(typed) > 0 {
+			err = text.typeText(string(typed))
+			typed = typed[:0]
+		}
+		if err == nil && len(unsupported) > 0 {
+			err = pasteText(string(unsupported), keys)
+			unsupported = unsupported[:0]
+		}
+		return err
+	}
 
-func typeString(str string, kb keybd_event.KeyBonding) error {
 	for _, char := range str {
-		// Reset the KeyBonding
-		kb.Clear()
-
-		// Determine the key code and whether Shift is needed
-		var keyCode int
-		needsShift := false
-
-		keyCode, needsShift = getKeyCode(char)
-		if keyCode == -1 {
-			// Skip unsupported characters
+		stroke, found := keys.layout[char]
+		if isText {
+			found = text.canType(char)
+		}
+		if !found {
+			if len(typed) > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			unsupported = append(unsupported, char)
 			continue
 		}
 
-		// Set Shift if needed
-		kb.HasSHIFT(needsShift)
-
-		// Set the key
-		kb.SetKeys(keyCode)
-
-		// kb.Launching is slow
-		kb.Press()
-		kb.Release()
-	}
-
-	return nil
-}
-
-// Helper function to get the appropriate key code and shift status
-func getKeyCode(char rune) (int, bool) {
-	// Check uppercase letters first
-	if keyCode, ok := charToKeyCode[unicode.ToLower(char)]; ok {
-		return keyCode, unicode.IsUpper(char)
-	}
-
-	// Check numbers
-	if keyCode, ok := numberToKeyCode[char]; ok {
-		return keyCode, false
-	}
+		if len(unsupported) > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
 
-	// Check special characters
-	if keyCode, ok := specialKeys[char]; ok {
-		return keyCode, false
-	}
+		if isText {
+			typed = append(typed, char)
+			continue
+		}
 
-	if keyCode, ok := shiftedSpecialKeys[char]; ok {
-		return keyCode, true
+		err := keys.keyboard.tap(chord{key: stroke.key, shift: stroke.shift, altgr: stroke.altgr}, 1)
+		if err != nil {
+			return err
+		}
 	}
 
-	// Unsupported character
-	return -1, false
+	return flush()
 }
 
 // pasteString is an alternative to typing the string. Typing uses
 // actual keystrokes which could cause issue if we are not in a text
 // field or if we have random control keys pressed down.
-func pasteString(str string, kb keybd_event.KeyBonding) error {
-	// Store the current clipboard content
-	currentContent, err := clipboard.ReadAll()
+func pasteString(str string, keys *keyboardOutput) error {
+	err := keys.ready()
 	if err != nil {
 		return err
 	}
+	return pasteText(str, keys)
+}
+
+// pasteText pastes the text, without checking for held modifiers
+func pasteText(str string, keys *keyboardOutput) error {
+	// Store the current clipboard content. Reading fails or comes back
+	// empty for images and other content that is not text, which we
+	// cannot put back, so the text is left on the clipboard then.
+	previous, err := keys.selection.read()
+	restore := err == nil && previous != "" && !keys.keepClipboard
 
 	// Write the new string to the clipboard
-	err = clipboard.WriteAll(str)
+	err = keys.selection.write(str)
 	if err != nil {
 		return err
 	}
 
 	// Paste the new string
-	kb.SetKeys(keybd_event.VK_V)
-	kb.HasSuper(true)
-	err = kb.Launching()
+	err = keys.keyboard.tap(keys.paste.focused(), 1)
 	if err != nil {
 		return err
 	}
 
-	// Restore the original clipboard content
-	// Looks like if you do this fast enough clipboard managers don't get to store it
-	err = clipboard.WriteAll(currentContent)
-	if err != nil {
-		return err
+	if !restore {
+		return nil
 	}
 
-	return nil
+	// Give the application time to read the clipboard before restoring
+	// it. Clipboard managers might store the text if this is too long.
+	time.Sleep(keys.restoreDelay)
+
+	// Leave it alone if something else was copied in the meantime
+	current, err := keys.selection.read()
+	if err != nil || current != str {
+		return nil
+	}
+	return keys.selection.write(previous)
 }
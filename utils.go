@@ -12,11 +12,14 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gordonklaus/portaudio"
 	"github.com/hajimehoshi/go-mp3"
 	"github.com/hajimehoshi/oto"
+	"github.com/rivo/uniseg"
 	"golang.design/x/hotkey"
+	"golang.org/x/exp/slices"
 )
 
 var mu sync.Mutex
@@ -58,8 +61,49 @@ func createWAVHeader(dataSize uint32) wavHeader {
 	}
 }
 
+// wavData prepends a wav header to the recorded 16 bit PCM audio
+func wavData(pcm []byte) []byte {
+	var buf bytes.Buffer
+	header := createWAVHeader(uint32(len(pcm)))
+
+	// Writing to a bytes.Buffer does not fail
+	_ = binary.Write(&buf, binary.LittleEndian, header)
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+// recording is an audio buffer that can be read from while we are
+// still recording into it
+type recording struct {
+	mu  sync.Mutex
+	pcm []byte
+}
+
+func (r *recording) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pcm = append(r.pcm, p...)
+	return len(p), nil
+}
+
+// Bytes returns the audio recorded so far. We only ever append to the
+// buffer, so it is safe to hand out a capped slice of it.
+func (r *recording) Bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pcm[:len(r.pcm):len(r.pcm)]
+}
+
 func recordAudioWithDynamicNoiseFloor(cancel <-chan hotkey.Event, cancelOnSilence bool) *bytes.Buffer {
 	audioBuffer := &bytes.Buffer{}
+	recordAudio(cancel, cancelOnSilence, audioBuffer)
+	return audioBuffer
+}
+
+// recordAudio records from the default input device into audioBuffer
+// until cancelled, or till the noise level dips if cancelOnSilence is
+// set.
+func recordAudio(cancel <-chan hotkey.Event, cancelOnSilence bool, audioBuffer io.Writer) {
 	in := make([]int16, 512)
 	stream, err := portaudio.OpenDefaultStream(1, 0, sampleRate, len(in), in)
 	if err != nil {
@@ -96,9 +140,9 @@ func recordAudioWithDynamicNoiseFloor(cancel <-chan hotkey.Event, cancelOnSilenc
 	for {
 		select {
 		case <-stopChan:
-			return audioBuffer
+			return
 		case <-cancel:
-			return audioBuffer
+			return
 		default:
 			err = stream.Read()
 			if err != nil {
@@ -138,7 +182,7 @@ func recordAudioWithDynamicNoiseFloor(cancel <-chan hotkey.Event, cancelOnSilenc
 							silenceCount++
 							if silenceCount > 5 { // Stop after 5 consecutive low-noise windows
 								fmt.Fprintf(os.Stderr, "\nNoise level dipped, stopping recording.\n")
-								return audioBuffer
+								return
 							}
 						} else {
 							silenceCount = 0
@@ -186,3 +230,70 @@ func playAudio() error {
 	}
 	return nil
 }
+
+// speechRatio returns the fraction of 30ms frames in the recording
+// (16 bit PCM) that are loud enough to be speech. A frame counts as
+// speech if it is well above the noise floor, which we take as the
+// quietest tenth of the recording.
+func speechRatio(pcm []byte) float64 {
+	const frameSize = sampleRate * 30 / 1000
+
+	samples := make([]int16, len(pcm)/2)
+	err := binary.Read(bytes.NewReader(pcm[:len(samples)*2]), binary.LittleEndian, samples)
+	if err != nil || len(samples) < frameSize {
+		return 0
+	}
+
+	levels := make([]float64, 0, len(samples)/frameSize)
+	for i := 0; i+frameSize <= len(samples); i += frameSize {
+		sum := 0.0
+		for _, sample := range samples[i : i+frameSize] {
+			amplitude := float64(sample) / math.MaxInt16
+			sum += amplitude * amplitude
+		}
+		levels = append(levels, math.Sqrt(sum/frameSize))
+	}
+
+	sorted := slices.Clone(levels)
+	slices.Sort(sorted)
+	threshold := math.Max(sorted[len(sorted)/10]*3, 0.01)
+
+	speech := 0
+	for _, level := range levels {
+		if level > threshold {
+			speech++
+		}
+	}
+	return float64(speech) / float64(len(levels))
+}
+
+// quietestPoint returns the byte offset of the quietest 100ms frame
+// within the last `within` of the recording. This is a good place to
+// split the audio without cutting through a word.
+func quietestPoint(pcm []byte, within time.Duration) int {
+	const frameBytes = sampleRate / 10 * 2
+
+	start := len(pcm) - int(within.Seconds()*sampleRate)*2
+	if start < 0 {
+		start = 0
+	}
+
+	best, bestLevel := len(pcm), math.Inf(1)
+	for i := start; i+frameBytes <= len(pcm); i += frameBytes {
+		sum := 0.0
+		for j := i; j+1 < i+frameBytes; j += 2 {
+			amplitude := float64(int16(binary.LittleEndian.Uint16(pcm[j:]))) / math.MaxInt16
+			sum += amplitude * amplitude
+		}
+		if sum < bestLevel {
+			best, bestLevel = i+frameBytes/2, sum
+		}
+	}
+	return best
+}
+
+// graphemeCount returns the number of user-perceived characters in the
+// text, which is the number of backspaces it takes to delete it
+func graphemeCount(text string) int {
+	return uniseg.GraphemeClusterCount(text)
+}
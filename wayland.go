@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// checkTools makes sure the commands are installed. The message is
+// used for the error, with the missing command filled in.
+func checkTools(message string, tools ...string) error {
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf(message, tool)
+		}
+	}
+	return nil
+}
+
+// runTool runs a command, including what it printed in the error if
+// it fails
+func runTool(stdin string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Keysyms for the key names that are not keysyms themselves
+var wtypeKeysyms = map[string]string{
+	"enter":        "Return",
+	"tab":          "Tab",
+	"backspace":    "BackSpace",
+	"insert":       "Insert",
+	"leftbracket":  "bracketleft",
+	"rightbracket": "bracketright",
+	"quote":        "apostrophe",
+	"iso":          "less",
+}
+
+// wtypeKeyboard sends keys using wtype, which works on compositors
+// that support the virtual keyboard protocol (most wlroots based ones)
+type wtypeKeyboard struct{}
+
+func (wtypeKeyboard) tap(c chord, times int) error {
+	var modifiers []string
+	for _, m := range []struct {
+		held bool
+		name string
+	}{{c.ctrl, "ctrl"}, {c.shift, "shift"}, {c.alt, "alt"}, {c.altgr, "altgr"}, {c.super, "logo"}} {
+		if m.held {
+			modifiers = append(modifiers, m.name)
+		}
+	}
+
+	keysym := c.name
+	if name, found := wtypeKeysyms[c.name]; found {
+		keysym = name
+	}
+
+	var args []string
+	for _, m := range modifiers {
+		args = append(args, "-M", m)
+	}
+	for i := 0; i < times; i++ {
+		args = append(args, "-k", keysym)
+	}
+	for _, m := range modifiers {
+		args = append(args, "-m", m)
+	}
+	return runTool("", "wtype", args...)
+}
+
+func (wtypeKeyboard) release() error {
+	return runTool("", "wtype", "-m", "ctrl", "-m", "shift", "-m", "alt", "-m", "altgr", "-m", "logo")
+}
+
+// wtype types any character, whatever the layout
+func (wtypeKeyboard) canType(rune) bool { return true }
+
+// typeText passes the text over stdin so that it is typed as is
+func (wtypeKeyboard) typeText(text string) error {
+	return runTool(text, "wtype", "-")
+}
+
+// Linux input event codes for the modifiers
+const (
+	evdevCtrl       = 29
+	evdevShift      = 42
+	evdevAlt        = 56
+	evdevSuper      = 125
+	evdevRightCtrl  = 97
+	evdevRightShift = 54
+	evdevRightAlt   = 100
+	evdevRightSuper = 126
+)
+
+// ydotoolKeyboard sends keys using ydotool, which goes through the
+// kernel and works everywhere, but needs ydotoold to be running. The
+// key codes are the Linux input event codes, which is what keybd_event
+// uses on Linux as well.
+type ydotoolKeyboard struct{}
+
+func (ydotoolKeyboard) tap(c chord, times int) error {
+	var modifiers []int
+	for _, m := range []struct {
+		held bool
+		code int
+	}{{c.ctrl, evdevCtrl}, {c.shift, evdevShift}, {c.alt, evdevAlt}, {c.altgr, evdevRightAlt}, {c.super, evdevSuper}} {
+		if m.held {
+			modifiers = append(modifiers, m.code)
+		}
+	}
+
+	args := []string{"key"}
+	for _, m := range modifiers {
+		args = append(args, strconv.Itoa(m)+":1")
+	}
+	for i := 0; i < times; i++ {
+		args = append(args, strconv.Itoa(c.key)+":1", strconv.Itoa(c.key)+":0")
+	}
+	for _, m := range modifiers {
+		args = append(args, strconv.Itoa(m)+":0")
+	}
+	return runTool("", "ydotool", args...)
+}
+
+func (ydotoolKeyboard) release() error {
+	args := []string{"key"}
+	for _, code := range []int{
+		evdevCtrl, evdevShift, evdevAlt, evdevSuper,
+		evdevRightCtrl, evdevRightShift, evdevRightAlt, evdevRightSuper,
+	} {
+		args = append(args, strconv.Itoa(code)+":0")
+	}
+	return runTool("", "ydotool", args...)
+}
+
+// ydotoolTextKeyboard types text using ydotool. ydotool types it as if
+// on a US layout, so it is only used with that layout.
+type ydotoolTextKeyboard struct{ ydotoolKeyboard }
+
+// ydotool only knows about the characters on a US keyboard
+func (ydotoolTextKeyboard) canType(char rune) bool {
+	return char == '\n' || char == '\t' || char >= ' ' && char <= '~'
+}
+
+func (ydotoolTextKeyboard) typeText(text string) error {
+	return runTool("", "ydotool", "type", "--", text)
+}
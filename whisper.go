@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// whisperOutput mirrors the parts of the full JSON output of
+// whisper-cli (-ojf) that we make use of.
+type whisperOutput struct {
+	Transcription []struct {
+		Text   string `json:"text"`
+		Tokens []struct {
+			Text string  `json:"text"`
+			P    float64 `json:"p"`
+		} `json:"tokens"`
+	} `json:"transcription"`
+}
+
+type transcription struct {
+	Text string
+
+	// Average of the per segment confidence, where the confidence of
+	// a segment is the mean probability of its tokens.
+	Confidence float64
+}
+
+// errWhisperTimeout is returned when whisper did not finish within
+// the configured timeout. The whisper process is killed in this case.
+var errWhisperTimeout = errors.New("whisper timed out")
+
+// transcribe runs whisper on the given wav data. We ask whisper to
+// write out the full JSON output in addition to printing the text so
+// that we can get the token probabilities.
+func transcribe(
+	ctx context.Context,
+	modelFile string,
+	wav []byte,
+	prompt, language string,
+	timeout time.Duration,
+) (*transcription, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	outDir, err := os.MkdirTemp("", "ojut")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outDir)
+
+	outFile := filepath.Join(outDir, "out")
+	cmd := exec.CommandContext(
+		ctx,
+		whisperBinary,
+		"-m",
+		modelFile,
+		"-f",
+		"-",
+		"-ojf",
+		"-of",
+		outFile,
+		"-np",
+		"-nt",
+		"-l",
+		language,
+		"--prompt",
+		prompt)
+	cmd.Stdin = bytes.NewReader(wav)
+
+	// Don't wait forever on the output pipes once the process has
+	// been killed
+	cmd.WaitDelay = time.Second
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after %s", errWhisperTimeout, timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	data, err := os.ReadFile(outFile + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read whisper output: %w", err)
+	}
+
+	var output whisperOutput
+	err = json.Unmarshal(data, &output)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse whisper output: %w", err)
+	}
+
+	return &transcription{
+		Text:       strings.TrimSpace(out.String()),
+		Confidence: averageConfidence(output),
+	}, nil
+}
+
+func averageConfidence(output whisperOutput) float64 {
+	var total float64
+	var segments int
+	for _, segment := range output.Transcription {
+		var sum float64
+		var count int
+		for _, token := range segment.Tokens {
+			// Skip special tokens like [_BEG_] and timestamps
+			if strings.HasPrefix(token.Text, "[_") {
+				continue
+			}
+			sum += token.P
+			count++
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		total += sum / float64(count)
+		segments++
+	}
+
+	if segments == 0 {
+		return 0
+	}
+	return total / float64(segments)
+}
+
+func modelName(modelFile string) string {
+	return strings.TrimSuffix(filepath.Base(modelFile), ".bin")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const focusedWindowScript = `tell application "System Events"
+	set frontApp to first application process whose frontmost is true
+	set windowTitle to ""
+	try
+		set windowTitle to name of front window of frontApp
+	end try
+	return (name of frontApp) & linefeed & windowTitle
+end tell`
+
+// focusedWindow returns the name of the frontmost application and the
+// title of its focused window
+func focusedWindow() (string, string, error) {
+	out, err := exec.Command("osascript", "-e", focusedWindowScript).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("osascript failed: %w", err)
+	}
+
+	class, title, _ := strings.Cut(strings.TrimRight(string(out), "\n"), "\n")
+	return class, title, nil
+}
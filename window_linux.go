@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var xpropString = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// xpropStrings returns the quoted values of a property in the output
+// of xprop, like WM_CLASS(STRING) = "kitty", "kitty"
+func xpropStrings(out, property string) []string {
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, property+"(") {
+			continue
+		}
+
+		var values []string
+		for _, quoted := range xpropString.FindAllString(line, -1) {
+			value, err := strconv.Unquote(quoted)
+			if err != nil {
+				value = strings.Trim(quoted, `"`)
+			}
+			values = append(values, value)
+		}
+		return values
+	}
+	return nil
+}
+
+// focusedWindow returns the class and title of the focused X11 window
+func focusedWindow() (string, string, error) {
+	out, err := exec.Command("xprop", "-root", "_NET_ACTIVE_WINDOW").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("xprop failed: %w", err)
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 || !strings.HasPrefix(fields[len(fields)-1], "0x") {
+		return "", "", fmt.Errorf("no active window")
+	}
+
+	out, err = exec.Command("xprop", "-id", fields[len(fields)-1], "WM_CLASS", "_NET_WM_NAME", "WM_NAME").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("xprop failed: %w", err)
+	}
+
+	// WM_CLASS has the instance name followed by the class name
+	class := ""
+	if values := xpropStrings(string(out), "WM_CLASS"); len(values) > 0 {
+		class = values[len(values)-1]
+	}
+
+	title := ""
+	if values := xpropStrings(string(out), "_NET_WM_NAME"); len(values) > 0 {
+		title = values[0]
+	} else if values := xpropStrings(string(out), "WM_NAME"); len(values) > 0 {
+		title = values[0]
+	}
+
+	return class, title, nil
+}
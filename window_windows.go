@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	user32              = syscall.NewLazyDLL("user32.dll")
+	getForegroundWindow = user32.NewProc("GetForegroundWindow")
+	getWindowTextW      = user32.NewProc("GetWindowTextW")
+	getClassNameW       = user32.NewProc("GetClassNameW")
+)
+
+// focusedWindow returns the class and title of the foreground window
+func focusedWindow() (string, string, error) {
+	hwnd, _, _ := getForegroundWindow.Call()
+	if hwnd == 0 {
+		return "", "", fmt.Errorf("no foreground window")
+	}
+
+	buf := make([]uint16, 512)
+	n, _, _ := getClassNameW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	class := syscall.UTF16ToString(buf[:n])
+
+	n, _, _ = getWindowTextW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	title := syscall.UTF16ToString(buf[:n])
+
+	return class, title, nil
+}